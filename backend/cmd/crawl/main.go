@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/knchan0x/belle-maison/backend/internal/config"
+	"github.com/knchan0x/belle-maison/backend/internal/crawler"
+	"github.com/knchan0x/belle-maison/backend/internal/db"
+	"github.com/knchan0x/belle-maison/backend/internal/db/model/product"
+	"gorm.io/gorm"
+)
+
+// crawl runs the crawler and prints what the parser sees,
+// i.e. to check the parser after the site changed.
+//
+// Inputs are product codes, urls of product pages, sku or html files saved,
+// i.e. snapshots of archive (.html.gz).
+//
+// Usage: go run . [-site site] [-format table|json|csv] [-save-html dir] [-diff] input...
+var (
+	site     = flag.String("site", crawler.DEFAULT_SITE, "site of product codes and html files")
+	format   = flag.String("format", FORMAT_TABLE, "output format: table, json or csv")
+	saveHTML = flag.String("save-html", "", "save pages fetched to the directory, as <site>_<product code>.html")
+	diff     = flag.Bool("diff", false, "compare with the product and the latest prices stored in db")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] product code|url|sku|file...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	out, err := newWriter(os.Stdout, *format, *diff)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	// config is optional unless comparing with db
+	configLoaded := config.LoadConfig() == nil
+	if configLoaded {
+		if err := config.LoadSelectors(); err != nil {
+			log.Fatalln(err)
+		}
+	} else if *diff {
+		log.Fatalln("config.yaml is required to compare with db")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// printed in the order of inputs
+	results := make([]*crawler.Result, flag.NArg())
+	codes := []string{}
+	pending := map[string][]int{} // product code -> index of inputs
+	for idx, input := range flag.Args() {
+		if isFile(input) {
+			results[idx] = parseFile(*site, input)
+			continue
+		}
+		ref, err := crawler.NormalizeProductCode(*site, input)
+		if err != nil {
+			results[idx] = &crawler.Result{Site: *site, ProductCode: input, Err: err, Class: crawler.Classify(err)}
+			continue
+		}
+		code := crawler.JoinCode(ref.Site, ref.ProductCode)
+		if _, ok := pending[code]; !ok {
+			codes = append(codes, code)
+		}
+		pending[code] = append(pending[code], idx)
+	}
+
+	if len(codes) > 0 {
+		opts := []crawler.Option{}
+		if configLoaded {
+			opts = append(opts, config.CrawlerOptions()...)
+		}
+		if *saveHTML != "" {
+			saver, err := newHTMLSaver(*saveHTML, codes)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			opts = append(opts, crawler.WithClientWrapper(saver.wrap))
+		}
+
+		c, err := crawler.NewCrawler(opts...)
+		if err != nil {
+			log.Fatalf("failed to initialize crawler: %v", err)
+		}
+		for _, result := range c.ScrapingContext(ctx, codes...) {
+			for _, idx := range pending[crawler.JoinCode(result.Site, result.ProductCode)] {
+				results[idx] = result
+			}
+		}
+	}
+
+	if !*diff {
+		for _, result := range results {
+			out.result(result)
+		}
+		exit(out.flush())
+	}
+
+	dbClient := connectDB()
+	for _, result := range results {
+		changes, err := diffResult(dbClient, result)
+		out.diff(result, changes, err)
+	}
+	if sqlDB, err := dbClient.DB(); err == nil {
+		sqlDB.Close()
+	}
+	exit(out.flush())
+}
+
+// exit exits with 1 if any product failed
+func exit(err error) {
+	if err != nil {
+		if !errors.Is(err, errFailed) {
+			log.Println(err)
+		}
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// isFile returns true if input is a file, not a product code or url
+func isFile(input string) bool {
+	info, err := os.Stat(input)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// parseFile parses html file, gzipped or not. Product code is taken from
+// the name, i.e. bellemaison_1129250.html, or archive path, i.e.
+// <dir>/bellemaison/1129250/20231001T000000Z.html.gz
+func parseFile(site, path string) *crawler.Result {
+	code := fileProductCode(site, path)
+
+	html, err := readFile(path)
+	if err != nil {
+		return &crawler.Result{Site: site, ProductCode: code, Err: err, Class: crawler.Classify(err)}
+	}
+	return crawler.ParsePage(site, code, html)
+}
+
+// fileProductCode returns product code found in the path, or the path if not found
+func fileProductCode(site, path string) string {
+	name := strings.SplitN(filepath.Base(path), ".", 2)[0]
+	name = strings.TrimPrefix(name, site+"_")
+	for _, candidate := range []string{name, filepath.Base(filepath.Dir(path))} {
+		if ref, err := crawler.NormalizeProductCode(site, candidate); err == nil && ref.Site == site {
+			return ref.ProductCode
+		}
+	}
+	return path
+}
+
+func readFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// gzip magic number, i.e. snapshot of archive
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	}
+	return data, nil
+}
+
+func connectDB() *gorm.DB {
+	db.SetDebugMode(config.GetBool("debug"))
+	dbClient, err := db.NewGORMClient(&db.DbSettings{
+		Host:     config.GetString("mysql.host"),
+		Port:     config.GetString("mysql.port"),
+		DB:       config.GetString("mysql.db"),
+		User:     config.GetString("mysql.user"),
+		Password: config.GetString("mysql.password"),
+		PoolSize: 2,
+	})
+	if err != nil {
+		log.Fatalf("failed to connect database: %v", err)
+	}
+	return dbClient
+}
+
+// diffResult compares the result with db, error returned
+// if the product cannot be compared
+func diffResult(dbClient *gorm.DB, result *crawler.Result) ([]product.Change, error) {
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	p, err := product.GetProductByCode(dbClient, result.Site, result.ProductCode)
+	if err != nil {
+		return nil, fmt.Errorf("not stored: %w", err)
+	}
+	return p.Diff(dbClient, result.Product)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/knchan0x/belle-maison/backend/internal/crawler"
+	"github.com/knchan0x/belle-maison/backend/internal/db/model/product"
+)
+
+const (
+	FORMAT_TABLE = "table"
+	FORMAT_JSON  = "json"
+	FORMAT_CSV   = "csv"
+)
+
+var errFailed = errors.New("some products failed")
+
+var (
+	resultHeader = []string{"CODE", "NAME", "EXTRACTOR", "STYLE", "COLOUR", "SIZE", "PRICE", "REGULAR", "SALE", "DISCOUNT", "POINTS", "STOCK", "REJECTED", "ERROR"}
+	diffHeader   = []string{"CODE", "STYLE", "FIELD", "STORED", "PARSED", "ERROR"}
+)
+
+// jsonResult is crawler.Result with error as text
+type jsonResult struct {
+	Site        string
+	ProductCode string
+	Product     *crawler.Product `json:",omitempty"`
+	Unchanged   bool
+	Error       string `json:",omitempty"`
+	Class       crawler.ErrorClass
+}
+
+// jsonDiff is changes of a product
+type jsonDiff struct {
+	Site        string
+	ProductCode string
+	Changes     []product.Change
+	Error       string `json:",omitempty"`
+}
+
+// writer collects results and prints them in the format on flush
+type writer struct {
+	w       io.Writer
+	format  string
+	header  []string
+	rows    [][]string    // table and csv
+	records []interface{} // json
+	failed  bool
+}
+
+func newWriter(w io.Writer, format string, diff bool) (*writer, error) {
+	switch format {
+	case FORMAT_TABLE, FORMAT_JSON, FORMAT_CSV:
+	default:
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+
+	header := resultHeader
+	if diff {
+		header = diffHeader
+	}
+	return &writer{w: w, format: format, header: header}, nil
+}
+
+// result adds a row per style of the product
+func (w *writer) result(r *crawler.Result) {
+	code := crawler.JoinCode(r.Site, r.ProductCode)
+	if r.Err != nil {
+		w.failed = true
+	}
+
+	if w.format == FORMAT_JSON {
+		w.records = append(w.records, jsonResult{
+			Site:        r.Site,
+			ProductCode: r.ProductCode,
+			Product:     r.Product,
+			Unchanged:   r.Unchanged,
+			Error:       errorText(r.Err),
+			Class:       r.Class,
+		})
+		return
+	}
+
+	if r.Product == nil || len(r.Product.Styles) == 0 {
+		row := make([]string, len(resultHeader))
+		row[0], row[len(row)-1] = code, errorText(r.Err)
+		if r.Product != nil {
+			row[1], row[2] = r.Product.Name, r.Product.Extractor
+		}
+		w.rows = append(w.rows, row)
+		return
+	}
+
+	for _, s := range r.Product.Styles {
+		w.rows = append(w.rows, []string{
+			code, r.Product.Name, r.Product.Extractor, s.StyleCode, s.Colour, s.Size,
+			fmt.Sprint(s.Price), fmt.Sprint(s.RegularPrice), fmt.Sprint(s.SalePrice),
+			fmt.Sprintf("%d%%", s.Discount), fmt.Sprint(s.Points), s.Stock.String(), rejectedText(&s), errorText(r.Err),
+		})
+	}
+}
+
+// diff adds a row per change of the product
+func (w *writer) diff(r *crawler.Result, changes []product.Change, err error) {
+	code := crawler.JoinCode(r.Site, r.ProductCode)
+	if err != nil {
+		w.failed = true
+	}
+
+	if w.format == FORMAT_JSON {
+		w.records = append(w.records, jsonDiff{
+			Site:        r.Site,
+			ProductCode: r.ProductCode,
+			Changes:     changes,
+			Error:       errorText(err),
+		})
+		return
+	}
+
+	if err != nil {
+		w.rows = append(w.rows, []string{code, "", "", "", "", errorText(err)})
+		return
+	}
+	for _, c := range changes {
+		w.rows = append(w.rows, []string{code, c.Style, c.Field, c.Stored, c.Parsed, ""})
+	}
+}
+
+// flush prints all collected, errFailed returned if any product failed
+func (w *writer) flush() error {
+	var err error
+	switch w.format {
+	case FORMAT_JSON:
+		enc := json.NewEncoder(w.w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(w.records)
+	case FORMAT_CSV:
+		cw := csv.NewWriter(w.w)
+		cw.Write(w.header)
+		cw.WriteAll(w.rows)
+		err = cw.Error()
+	default:
+		tw := tabwriter.NewWriter(w.w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(w.header, "\t"))
+		for _, row := range w.rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		err = tw.Flush()
+	}
+
+	if err != nil {
+		return err
+	}
+	if w.failed {
+		return errFailed
+	}
+	return nil
+}
+
+// rejectedText returns reason the price rejected with the raw price, i.e. `invalid price ("abc")`
+func rejectedText(s *crawler.Style) string {
+	if s.Rejected == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s (%q)", s.Rejected, s.RawPrice)
+}
+
+// errorText returns err in one line, i.e. errors joined
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return strings.ReplaceAll(err.Error(), "\n", "; ")
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/knchan0x/belle-maison/backend/internal/crawler"
+)
+
+// htmlSaver saves product pages received, other responses,
+// i.e. robots.txt, are passed through untouched
+type htmlSaver struct {
+	dir   string
+	pages map[string]string // request uri of product page -> file name
+}
+
+func newHTMLSaver(dir string, codes []string) (*htmlSaver, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &htmlSaver{dir: dir, pages: make(map[string]string)}
+	for _, code := range codes {
+		site, productCode := crawler.SplitCode(code)
+		adapter, ok := crawler.GetSiteAdapter(site)
+		if !ok {
+			continue
+		}
+		u, err := url.Parse(adapter.ProductURL(productCode))
+		if err != nil {
+			continue
+		}
+		s.pages[u.RequestURI()] = site + "_" + productCode + ".html"
+	}
+	return s, nil
+}
+
+func (s *htmlSaver) wrap(client crawler.HTTPClient) crawler.HTTPClient {
+	return &savingClient{client: client, saver: s}
+}
+
+// name returns file name of the page requested, the path may be
+// prefixed if sent to a base url, see crawler.WithBaseURL
+func (s *htmlSaver) name(u *url.URL) (string, bool) {
+	uri := u.RequestURI()
+	for page, name := range s.pages {
+		if strings.HasSuffix(uri, page) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+type savingClient struct {
+	client crawler.HTTPClient
+	saver  *htmlSaver
+}
+
+func (c *savingClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	name, ok := c.saver.name(req.URL)
+	if !ok {
+		return resp, nil
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+
+	path := filepath.Join(c.saver.dir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		log.Printf("failed to save %s: %v", path, err)
+	} else {
+		log.Printf("saved %s", path)
+	}
+	return resp, nil
+}
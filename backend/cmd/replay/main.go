@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"github.com/knchan0x/belle-maison/backend/internal/config"
+	"github.com/knchan0x/belle-maison/backend/internal/crawler"
+	"github.com/knchan0x/belle-maison/backend/internal/db"
+	"github.com/knchan0x/belle-maison/backend/internal/db/model/product"
+)
+
+// replay parses archived snapshots with the current parser and
+// rewrites the price history, i.e. to fix history after a parser bug.
+//
+// Usage: go run . [-dir archive] [-site site] [-code productCode] [-from 2006-01-02] [-to 2006-01-02] [-window 30m] [-dry-run]
+var (
+	dir    = flag.String("dir", "", "archive directory, default: crawler.archive_dir in config.yaml")
+	site   = flag.String("site", "", "replay snapshots of the site only")
+	code   = flag.String("code", "", "replay snapshots of the product code only")
+	from   = flag.String("from", "", "replay snapshots taken on or after the date, format: 2006-01-02")
+	to     = flag.String("to", "", "replay snapshots taken before the date, format: 2006-01-02")
+	window = flag.Duration("window", 30*time.Minute, "price recorded within the window from the snapshot will be replaced")
+	dryRun = flag.Bool("dry-run", false, "parse snapshots without updating db")
+)
+
+func init() {
+	log.Println("Initializing, please wait...")
+	if err := config.LoadConfig(); err != nil {
+		log.Fatalln(err)
+	}
+	if err := config.LoadSelectors(); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	if *dir == "" {
+		*dir = config.GetString("crawler.archive_dir")
+	}
+	if *dir == "" {
+		log.Fatalln("no archive directory provided")
+	}
+
+	start, end := parseDate(*from), parseDate(*to)
+
+	snapshots, err := crawler.NewArchive(*dir).Snapshots(*site, *code)
+	if err != nil {
+		log.Fatalf("failed to list snapshots: %v", err)
+	}
+
+	// config db connection
+	db.SetDebugMode(config.GetBool("debug"))
+	dbClient, err := db.NewGORMClient(&db.DbSettings{
+		Host:     config.GetString("mysql.host"),
+		Port:     config.GetString("mysql.port"),
+		DB:       config.GetString("mysql.db"),
+		User:     config.GetString("mysql.user"),
+		Password: config.GetString("mysql.password"),
+		PoolSize: 2,
+	})
+	if err != nil {
+		log.Panicln("Failed to connect database")
+	}
+	defer func() {
+		if sqlDB, err := dbClient.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}()
+
+	replayed, updated, created := 0, 0, 0
+	for _, snapshot := range snapshots {
+		if !start.IsZero() && snapshot.Time.Before(start) || !end.IsZero() && !snapshot.Time.Before(end) {
+			continue
+		}
+
+		name := crawler.JoinCode(snapshot.Site, snapshot.ProductCode) + "@" + snapshot.Time.Format(time.RFC3339)
+		result := snapshot.Parse()
+		if result.Err != nil {
+			log.Printf("%s: %v", name, result.Err)
+			continue
+		}
+		if *dryRun {
+			log.Printf("%s: %s, %d styles", name, result.Product.Name, len(result.Product.Styles))
+			continue
+		}
+
+		p, err := product.GetProductByCode(dbClient, snapshot.Site, snapshot.ProductCode)
+		if err != nil {
+			log.Printf("%s: %v", name, err)
+			continue
+		}
+
+		u, c, err := p.Replay(dbClient, result, snapshot.Time, *window)
+		if err != nil {
+			log.Printf("%s: %v", name, err)
+			continue
+		}
+		replayed++
+		updated += u
+		created += c
+	}
+
+	log.Printf("Done, %d snapshots replayed, %d prices updated, %d prices created", replayed, updated, created)
+}
+
+// parseDate parses date in format 2006-01-02, returns zero time if empty
+func parseDate(date string) time.Time {
+	if date == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		log.Fatalf("invalid date %q: %v", date, err)
+	}
+	return t
+}
@@ -16,6 +16,9 @@ func init() {
 	if err := config.LoadConfig(); err != nil {
 		log.Fatalln(err)
 	}
+	if err := config.LoadSelectors(); err != nil {
+		log.Fatalln(err)
+	}
 }
 
 func main() {
@@ -79,6 +82,7 @@ func main() {
 
 	<-quit
 	log.Println("Shutting down crawler...")
+	s.Shutdown()
 
 	// close db connection before exit
 	if sqlDB, err := dbClient.DB(); err == nil {
@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/go-co-op/gocron"
+	"github.com/knchan0x/belle-maison/backend/internal/config"
 	"github.com/knchan0x/belle-maison/backend/internal/crawler"
 	"github.com/knchan0x/belle-maison/backend/internal/db/model/product"
 	"github.com/knchan0x/belle-maison/backend/internal/db/model/target"
 	"github.com/knchan0x/belle-maison/backend/internal/email"
+	"github.com/knchan0x/belle-maison/backend/internal/imagestore"
 	"gorm.io/gorm"
 )
 
@@ -19,25 +24,52 @@ type scheduler struct {
 	*gocron.Scheduler
 	crawler  crawler.Crawler
 	dbClient *gorm.DB
-	jobs     []string // tasks pending to perform
+	jobs     []string          // tasks pending to perform
+	images   *imagestore.Store // nil if image mirroring disabled
+
+	alertThreshold float64 // share of failing products considered as broken
+	alerted        bool    // alert sent, not sent again until recovered
+
+	ctx    context.Context // cancelled on shutdown
+	cancel context.CancelFunc
 }
 
 // NewScheduler returns new scheduler
 func NewScheduler(dbClient *gorm.DB) *scheduler {
-	c, err := crawler.NewCrawler()
+	c, err := crawler.NewCrawler(config.CrawlerOptions()...)
 	if err != nil {
 		log.Fatalf("failed to initialize crawler: %v", err)
 	}
 
+	threshold := config.GetFloat64("scheduler.alert_threshold")
+	if threshold <= 0 {
+		threshold = DefaultAlertThreshold
+	}
+
 	s := &scheduler{
-		crawler:  c,
-		dbClient: dbClient,
-		jobs:     []string{},
+		crawler:        c,
+		dbClient:       dbClient,
+		jobs:           []string{},
+		alertThreshold: threshold,
+	}
+	if dir := config.GetString("images.dir"); dir != "" {
+		store, err := imagestore.New(dir, c.Client())
+		if err != nil {
+			log.Fatalf("failed to initialize image store: %v", err)
+		}
+		s.images = store
 	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
 	s.Scheduler = gocron.NewScheduler(time.UTC)
 	return s
 }
 
+// Shutdown cancels the running crawl and waits for running jobs to finish
+func (s *scheduler) Shutdown() {
+	s.cancel()
+	s.Stop()
+}
+
 // StartScraping activates crawler to preform scraping tasks
 func (s *scheduler) StartScraping() {
 	log.Println("Start scraping...")
@@ -46,33 +78,187 @@ func (s *scheduler) StartScraping() {
 		return
 	}
 
-	// fetch
-	results := s.crawler.Scraping(s.jobs...)
+	// jobs failed will be added back during scraping
+	jobs := s.jobs
 	s.cleanJobs()
 
-	for _, result := range results {
-		if result.Err != nil && result.Err != crawler.PRODUCT_NOT_FOUND {
-			s.jobs = append(s.jobs, result.ProductCode)
-			continue
+	// save each product as soon as it is parsed
+	failed, drifted, blocked := 0, 0, 0
+	for result := range s.crawler.Stream(s.ctx, jobs...) {
+		if err := s.save(result); err != nil {
+			code := crawler.JoinCode(result.Site, result.ProductCode)
+			log.Printf("%s: %v", code, err)
+
+			// not saved, must not be reported as unchanged next time,
+			// products failed by crawler are not remembered anyway and
+			// style drops are counted against the product remembered
+			if result.Err == nil || result.Err == crawler.PRODUCT_NOT_FOUND {
+				s.crawler.Invalidate(code)
+			}
+
+			failed++
+			var blockedErr *crawler.BlockedError
+			if errors.Is(err, crawler.ErrParseDrift) {
+				drifted++
+			} else if errors.As(err, &blockedErr) || errors.Is(err, crawler.ErrCircuitOpen) {
+				blocked++
+			}
 		}
+	}
 
-		p, err := product.GetProductByCode(s.dbClient, result.ProductCode)
-		if err != nil && err != gorm.ErrRecordNotFound {
-			s.jobs = append(s.jobs, result.ProductCode)
-			continue
+	// interrupted by shutdown, failures are not caused by the site
+	if s.ctx.Err() == nil {
+		s.checkHealth(len(jobs), failed, drifted, blocked)
+	}
+	log.Println("Done")
+
+	s.MirrorImages()
+}
+
+const (
+	ImageBatchSize     = 100            // images mirrored per round
+	ImageRetryInterval = 24 * time.Hour // failed images are not retried within
+	ImageFetchInterval = 500 * time.Millisecond
+)
+
+// MirrorImages saves images of styles not mirrored yet to the image store
+func (s *scheduler) MirrorImages() {
+	if s.images == nil {
+		return
+	}
+
+	styles, err := product.StylesWithoutImage(s.dbClient, time.Now().Add(-ImageRetryInterval), ImageBatchSize)
+	if err != nil {
+		log.Printf("Failed to get styles without image: %v", err)
+		return
+	}
+	if len(styles) == 0 {
+		return
+	}
+
+	log.Printf("Mirroring %d images...", len(styles))
+	mirrored := 0
+	for idx := range styles {
+		if idx > 0 {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(ImageFetchInterval):
+			}
 		}
-		if err == gorm.ErrRecordNotFound {
-			if _, err := product.New(s.dbClient, result); err != nil {
-				s.jobs = append(s.jobs, result.ProductCode)
+
+		hash, err := s.images.Fetch(s.ctx, styles[idx].ImageUrl)
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return
 			}
-			continue
+			log.Printf("%s: %v", styles[idx].ImageUrl, err)
+		} else {
+			mirrored++
 		}
+		if err := styles[idx].SetImageHash(s.dbClient, hash); err != nil {
+			log.Printf("Failed to save image hash: %v", err)
+		}
+	}
+	log.Printf("Done, %d of %d images mirrored", mirrored, len(styles))
+}
 
-		if err := p.Update(s.dbClient, result); err != nil {
-			s.jobs = append(s.jobs, result.ProductCode)
+const (
+	DefaultAlertThreshold = 0.5
+)
+
+// checkHealth sends alert once if the share of failing products
+// exceeds the threshold, i.e. the markup of the site changed
+func (s *scheduler) checkHealth(total, failed, drifted, blocked int) {
+	if total == 0 {
+		return
+	}
+
+	share := float64(failed) / float64(total)
+	if share <= s.alertThreshold {
+		if s.alerted {
+			log.Println("Scraper recovered")
+		}
+		s.alerted = false
+		return
+	}
+
+	log.Printf("Scraper looks broken: %d of %d products failed, %d parser drifts, %d blocked", failed, total, drifted, blocked)
+	if s.alerted {
+		return
+	}
+
+	msg := fmt.Sprintf("Scraper looks broken: %d of %d products failed in the last scraping, %d of them due to parser drift.\n", failed, total, drifted)
+	if drifted > 0 {
+		msg += "The markup of the site may have changed, please check the selector file.\n"
+	}
+	if blocked > 0 {
+		msg += fmt.Sprintf("%d of them were blocked by maintenance, captcha or anti-bot pages, they will be retried later.\n", blocked)
+	}
+	if err := email.SendEmail("Belle Maison Price Tracker: scraper looks broken", msg); err != nil {
+		log.Println(err)
+		return
+	}
+	s.alerted = true
+}
+
+// save saves the result to db, product code will be
+// added back to jobs if the result should be retried
+func (s *scheduler) save(result *crawler.Result) error {
+	code := crawler.JoinCode(result.Site, result.ProductCode)
+	if result.Err != nil && result.Err != crawler.PRODUCT_NOT_FOUND {
+		// retry in next round only if it may succeed later
+		if result.Class == crawler.Transient {
+			s.jobs = append(s.jobs, code)
+		}
+		return result.Err
+	}
+
+	p, err := product.GetProductByCode(s.dbClient, result.Site, result.ProductCode)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		s.jobs = append(s.jobs, code)
+		return err
+	}
+	if err == gorm.ErrRecordNotFound {
+		if _, err := product.New(s.dbClient, result); err != nil {
+			s.jobs = append(s.jobs, code)
+			return err
+		}
+		logRejected(code, result.Product)
+		return nil
+	}
+
+	// compare with styles stored as the crawler may not know them, i.e. after restart.
+	// Style drops confirmed by the crawler are stored drops too, reported only.
+	if result.Err == nil && !result.Unchanged {
+		count, err := p.CurrentStyleCount(s.dbClient)
+		if err != nil {
+			s.jobs = append(s.jobs, code)
+			return err
+		}
+		if crawler.StyleDropped(count, len(result.Product.Styles)) {
+			log.Printf("%s: styles dropped from %d to %d, saved as product change", code, count, len(result.Product.Styles))
+		}
+	}
+
+	if err := p.Update(s.dbClient, result); err != nil {
+		s.jobs = append(s.jobs, code)
+		return err
+	}
+	logRejected(code, result.Product)
+	return nil
+}
+
+// logRejected logs styles of which price is not recorded as implausible
+func logRejected(code string, p *crawler.Product) {
+	if p == nil {
+		return
+	}
+	for _, style := range p.Styles {
+		if style.Rejected != "" {
+			log.Printf("%s: price of style %s rejected: %s, raw price %q", code, style.StyleCode, style.Rejected, style.RawPrice)
 		}
 	}
-	log.Println("Done")
 }
 
 const (
@@ -83,29 +269,39 @@ func (s *scheduler) GenerateDailyReport() {
 	log.Println("Generating daily report...")
 	targets := target.GetAll(s.dbClient)
 	emailMsg := ""
+	backorderMsg := ""
 	for _, target := range targets {
-		if target.Stock <= 0 {
+		stock := target.StockStatus()
+		if !stock.Available() {
+			if stock.State == crawler.Backorder {
+				backorderMsg += fmt.Sprintf("%s: %s\n", target.Name, stock)
+			}
 			continue // by pass if no stock available
 		}
 
-		// hit target
-		if target.Price <= target.TargetPrice {
+		// hit target, no price recorded if all rejected
+		if target.Price > 0 && target.Price <= target.TargetPrice {
 			if emailMsg == "" {
 				emailMsg += "The following products have achieved your target price: \n"
 			}
-			emailMsg += fmt.Sprintf("%s: target price: %d, current price: %d\n", target.Name, target.TargetPrice, target.Price)
+			emailMsg += fmt.Sprintf("%s: target price: %d, current price: %s\n", target.Name, target.TargetPrice, priceText(&target))
 			continue
 		}
 
 		// low stock
-		if target.Stock <= LowStockThreshold {
+		if stock.State == crawler.LowStock && stock.Quantity <= LowStockThreshold {
 			if emailMsg == "" {
 				emailMsg += "The following products have not achieved your target price but the stock is low now: \n"
 			}
-			emailMsg += fmt.Sprintf("%s: target price: %d, current price: %d", target.Name, target.TargetPrice, target.Price)
+			emailMsg += fmt.Sprintf("%s: target price: %d, current price: %s", target.Name, target.TargetPrice, priceText(&target))
 		}
 	}
 
+	// only sent together with other notices
+	if emailMsg != "" && backorderMsg != "" {
+		emailMsg += "\nThe following products are out of stock and will be restocked: \n" + backorderMsg
+	}
+
 	if emailMsg != "" {
 		if err := email.SendEmail("Belle Maison Price Tracker", emailMsg); err != nil {
 			log.Println(err)
@@ -115,6 +311,23 @@ func (s *scheduler) GenerateDailyReport() {
 	log.Println("Done")
 }
 
+// priceText returns current price with discount and points if any,
+// i.e. "7000 (30% off, regular price: 10000, 70 points)"
+func priceText(t *target.TargetInfo) string {
+	details := []string{}
+	if t.Discount > 0 {
+		details = append(details, fmt.Sprintf("%d%% off, regular price: %d", t.Discount, t.RegularPrice))
+	}
+	if t.Points > 0 {
+		details = append(details, fmt.Sprintf("%d points", t.Points))
+	}
+
+	if len(details) == 0 {
+		return fmt.Sprintf("%d", t.Price)
+	}
+	return fmt.Sprintf("%d (%s)", t.Price, strings.Join(details, ", "))
+}
+
 func (s *scheduler) cleanJobs() {
 	s.jobs = []string{}
 }
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knchan0x/belle-maison/backend/cmd/web/middleware"
+	"github.com/knchan0x/belle-maison/backend/internal/db/model/product"
+	"gorm.io/gorm"
+)
+
+// History is price history of a style downsampled
+type History struct {
+	StyleID  uint
+	From     time.Time
+	To       time.Time
+	Interval string // daily or weekly
+	Points   []product.PricePoint
+}
+
+// get price history of the style, the lowest, highest and
+// last price of each day or week
+// params: from, to, interval
+func GetStyleHistory(dbClient *gorm.DB) func(*gin.Context) {
+	return func(ctx *gin.Context) {
+		id := ctx.GetInt(middleware.Validated_StyleId)
+		from := ctx.GetTime(middleware.Validated_QueryFrom)
+		to := ctx.GetTime(middleware.Validated_QueryTo)
+		interval := ctx.GetString(middleware.Validated_QueryInterval)
+
+		style, err := product.GetStyleById(dbClient, uint(id))
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": "style not found"})
+			} else {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			}
+			return
+		}
+
+		prices, err := style.PriceHistoryBetween(dbClient, from, to)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			return
+		}
+
+		points, err := product.Downsample(prices, from, to, interval)
+		if errors.Is(err, product.TOO_MANY_PERIODS) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "time range too long"})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid interval"})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, History{
+			StyleID:  style.ID,
+			From:     from,
+			To:       to,
+			Interval: interval,
+			Points:   points,
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knchan0x/belle-maison/backend/internal/imagestore"
+)
+
+// Images serves images mirrored in Store under Path, i.e. /bellemaison/images
+type Images struct {
+	Store *imagestore.Store // nil if image mirroring disabled
+	Path  string
+}
+
+// URL returns url of the image or its thumbnail
+func (i *Images) URL(hash string, thumbnail bool) string {
+	if thumbnail {
+		return i.Path + "/" + hash + "/thumb"
+	}
+	return i.Path + "/" + hash
+}
+
+// get image or its thumbnail mirrored, images never change as named by content
+func GetImage(images *Images, thumbnail bool) func(*gin.Context) {
+	return func(ctx *gin.Context) {
+		if images.Store == nil {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "image not found"})
+			return
+		}
+
+		path, err := images.Store.Path(ctx.Param("hash"), thumbnail)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "image not found"})
+			return
+		}
+
+		ctx.Header("Cache-Control", "private, max-age=31536000, immutable")
+		ctx.File(path)
+	}
+}
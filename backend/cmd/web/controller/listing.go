@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/knchan0x/belle-maison/backend/cmd/web/middleware"
+	"github.com/knchan0x/belle-maison/backend/internal/cache"
+	"github.com/knchan0x/belle-maison/backend/internal/crawler"
+)
+
+const (
+	listingCachePrefix = "listing_result_"
+	listingCacheTime   = 10 * time.Minute
+)
+
+// search products, query: q, site, page
+func Search(s crawler.Crawler) func(*gin.Context) {
+
+	return func(ctx *gin.Context) {
+		site := ctx.GetString(middleware.Validated_Site)
+		q := ctx.GetString(middleware.Validated_SearchQuery)
+		page := ctx.GetInt(middleware.Validated_QueryPage)
+
+		listing(ctx, fmt.Sprintf("search_%s_%s_%d", site, q, page), func(c context.Context) (*crawler.Listing, error) {
+			return s.Search(c, site, q, page)
+		})
+	}
+}
+
+// get products of category, query: site, page
+func GetCategory(s crawler.Crawler) func(*gin.Context) {
+
+	return func(ctx *gin.Context) {
+		site := ctx.GetString(middleware.Validated_Site)
+		id := ctx.GetString(middleware.Validated_CategoryId)
+		page := ctx.GetInt(middleware.Validated_QueryPage)
+
+		listing(ctx, fmt.Sprintf("category_%s_%s_%d", site, id, page), func(c context.Context) (*crawler.Listing, error) {
+			return s.Category(c, site, id, page)
+		})
+	}
+}
+
+// listing responds listing fetched by list, it is cached under key
+// unless failed, i.e. blocked by the site
+func listing(ctx *gin.Context, key string, list func(context.Context) (*crawler.Listing, error)) {
+	if c, ok := cache.Get(listingCachePrefix + key); ok {
+		ctx.JSON(http.StatusOK, c.(*crawler.Listing))
+		return
+	}
+
+	l, err := list(ctx.Request.Context())
+	if errors.Is(err, crawler.ErrListingNotSupported) || errors.Is(err, crawler.ErrUnknownSite) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		// maintenance, captcha or host paused, may succeed later
+		if crawler.Classify(err) == crawler.Transient {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	cache.Add(listingCachePrefix+key, l, listingCacheTime)
+	ctx.JSON(http.StatusOK, l)
+}
@@ -18,13 +18,17 @@ const (
 func GetProduct(s crawler.Crawler) func(*gin.Context) {
 
 	return func(ctx *gin.Context) {
-		productCode := ctx.GetString(middleware.Validated_ProductCode)
+		code := crawler.JoinCode(
+			ctx.GetString(middleware.Validated_Site),
+			ctx.GetString(middleware.Validated_ProductCode))
 		var r *crawler.Result
-		if c, ok := cache.Get(cachePrefix + productCode); ok {
+		if c, ok := cache.Get(cachePrefix + code); ok {
 			r = c.(*crawler.Result)
 		} else {
-			r = s.Scraping(productCode)[0]
-			cache.Add(cachePrefix+productCode, r, time.Hour)
+			r = s.ScrapingContext(ctx.Request.Context(), code)[0]
+			if r.Err == nil || r.Class == crawler.Permanent {
+				cache.Add(cachePrefix+code, r, time.Hour)
+			}
 		}
 
 		if r.Err != nil {
@@ -22,7 +22,9 @@ const (
 // add target
 func AddTarget(dbClient *gorm.DB, s crawler.Crawler) func(*gin.Context) {
 	return func(ctx *gin.Context) {
+		site := ctx.GetString(middleware.Validated_Site)
 		productCode := ctx.GetString(middleware.Validated_ProductCode)
+		code := crawler.JoinCode(site, productCode)
 
 		// get most updated product info
 		var wg sync.WaitGroup
@@ -30,11 +32,13 @@ func AddTarget(dbClient *gorm.DB, s crawler.Crawler) func(*gin.Context) {
 
 		var r *crawler.Result
 		go func() {
-			if c, ok := cache.Get("crawler_result_" + productCode); ok {
+			if c, ok := cache.Get("crawler_result_" + code); ok {
 				r = c.(*crawler.Result)
 			} else {
-				r = s.Scraping(productCode)[0]
-				cache.Add("crawler_result_"+productCode, r, time.Hour)
+				r = s.ScrapingContext(ctx.Request.Context(), code)[0]
+				if r.Err == nil || r.Class == crawler.Permanent {
+					cache.Add("crawler_result_"+code, r, time.Hour)
+				}
 			}
 			wg.Done()
 		}()
@@ -42,7 +46,7 @@ func AddTarget(dbClient *gorm.DB, s crawler.Crawler) func(*gin.Context) {
 		var p *product.Product
 		var err error
 		go func() {
-			p, err = product.GetProductByCode(dbClient, productCode)
+			p, err = product.GetProductByCode(dbClient, site, productCode)
 			wg.Done()
 		}()
 
@@ -61,10 +65,28 @@ func AddTarget(dbClient *gorm.DB, s crawler.Crawler) func(*gin.Context) {
 			}
 		}
 
-		targetStyle, err := p.Style(
-			dbClient,
-			ctx.GetString(middleware.Validated_TargetColour),
-			ctx.GetString(middleware.Validated_TargetSize))
+		// style referred by sku or url is selected unless provided
+		colour := ctx.GetString(middleware.Validated_TargetColour)
+		size := ctx.GetString(middleware.Validated_TargetSize)
+		var parsed *crawler.Style
+		if ref, ok := ctx.Get(middleware.Validated_StyleRef); ok && colour == "" && size == "" {
+			if r.Product == nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid parameters"})
+				return
+			}
+			parsed = r.Product.FindStyle(ref.(*crawler.ProductRef))
+		} else if r.Product != nil {
+			parsed = r.Product.StyleByName(colour, size)
+		}
+
+		// styles are found by style code as colour and size
+		// are unknown if found by structured data only
+		var targetStyle *product.Style
+		if parsed != nil && parsed.StyleCode != "" {
+			targetStyle, err = p.StyleByCode(dbClient, parsed.StyleCode)
+		} else {
+			targetStyle, err = p.Style(dbClient, colour, size)
+		}
 
 		// style not found
 		if err != nil {
@@ -74,6 +96,7 @@ func AddTarget(dbClient *gorm.DB, s crawler.Crawler) func(*gin.Context) {
 
 		if _, err := target.New(
 			dbClient,
+			site,
 			productCode,
 			p.ID,
 			targetStyle.ID,
@@ -94,8 +117,8 @@ func AddTarget(dbClient *gorm.DB, s crawler.Crawler) func(*gin.Context) {
 }
 
 // get all products under tracing
-// params: page, size
-func GetTargets(dbClient *gorm.DB) func(*gin.Context) {
+// params: page, size, category
+func GetTargets(dbClient *gorm.DB, images *Images) func(*gin.Context) {
 	return func(ctx *gin.Context) {
 
 		page := ctx.GetInt(middleware.Validated_QueryPage)
@@ -109,6 +132,23 @@ func GetTargets(dbClient *gorm.DB) func(*gin.Context) {
 			cache.Add(targets_cache_key, targets, time.Hour*24)
 		}
 
+		// filter by category of any level
+		if category := ctx.GetString(middleware.Validated_QueryCategory); category != "" {
+			filtered := []target.TargetInfo{}
+			for idx := range targets {
+				if targets[idx].InCategory(category) {
+					filtered = append(filtered, targets[idx])
+				}
+			}
+			targets = filtered
+		}
+
+		// images may be mirrored after cached, cached targets must not be changed
+		targets = append([]target.TargetInfo(nil), targets...)
+		for idx := range targets {
+			targets[idx].UseLocalImage(images.Store, images.URL)
+		}
+
 		targetSize := len(targets)
 
 		if targetSize > size {
@@ -19,6 +19,7 @@ import (
 	"github.com/knchan0x/belle-maison/backend/internal/crawler"
 	"github.com/knchan0x/belle-maison/backend/internal/db"
 	"github.com/knchan0x/belle-maison/backend/internal/email"
+	"github.com/knchan0x/belle-maison/backend/internal/imagestore"
 )
 
 const (
@@ -33,6 +34,7 @@ const (
 	urlPrefix_logout    = "/logout"
 	urlPrefix_api       = "/api"
 	urlPrefix_asset     = "/assets"
+	urlPrefix_image     = "/images"
 )
 
 var (
@@ -45,6 +47,9 @@ func init() {
 	if err := config.LoadConfig(); err != nil {
 		log.Fatalln(err)
 	}
+	if err := config.LoadSelectors(); err != nil {
+		log.Fatalln(err)
+	}
 }
 
 func main() {
@@ -96,16 +101,25 @@ func main() {
 	middleware.ActivateRolePermit(!config.GetBool("debug"))
 
 	// configure crawler
-	crawler, err := crawler.NewCrawler()
+	crawler, err := crawler.NewCrawler(config.CrawlerOptions()...)
 	if err != nil {
 		log.Fatalf("failed to initialize crawler: %v", err)
 	}
 
+	// configure image store, mirrored by scheduler
+	images := &controller.Images{Path: urlPath_root + urlPrefix_image}
+	if dir := config.GetString("images.dir"); dir != "" {
+		if images.Store, err = imagestore.New(dir, crawler.Client()); err != nil {
+			log.Fatalf("failed to initialize image store: %v", err)
+		}
+	}
+
 	// set gin mode
 	gin.SetMode(gin.ReleaseMode)
 
 	// configure gin
 	web := gin.Default()
+	web.UseRawPath = true // url of product page escaped as :productCode
 	if config.GetBool("debug") {
 		web.Use(middleware.AllowCrossOrigin("http://localhost:3000")) // CORS
 	}
@@ -142,6 +156,12 @@ func main() {
 		middleware.NoCache())
 	dashboard.StaticFile("/", fileBasePath+"/index.html") // dashboard html
 
+	// images mirrored and their thumbnails, shown in dashboard only
+	image := root.Group(urlPrefix_image,
+		middleware.AccessControl(middleware.Admin, middleware.AuthMode_Unauthorized))
+	image.GET("/:hash", controller.GetImage(images, false))
+	image.GET("/:hash/thumb", controller.GetImage(images, true))
+
 	// api
 	api := root.Group(urlPrefix_api,
 		middleware.AccessControl(middleware.Admin, middleware.AuthMode_Unauthorized))
@@ -151,6 +171,18 @@ func main() {
 		middleware.Validate(middleware.ProductCode),
 		controller.GetProduct(crawler))
 
+	// find products, query: q, site, page
+	api.GET("/search",
+		middleware.Validate(middleware.SearchQuery),
+		middleware.Validate(middleware.QueryListingPage),
+		controller.Search(crawler))
+
+	// get products of category, query: site, page
+	api.GET("/category/:categoryId",
+		middleware.Validate(middleware.CategoryId),
+		middleware.Validate(middleware.QueryListingPage),
+		controller.GetCategory(crawler))
+
 	// POST content: colour, size
 	api.POST("/target/:productCode",
 		middleware.Validate(middleware.ProductCode),
@@ -166,7 +198,15 @@ func main() {
 	// get all products under tracing
 	api.GET("/targets",
 		middleware.Validate(middleware.QueryPageSize),
-		controller.GetTargets(dbClient))
+		middleware.Validate(middleware.QueryCategory),
+		controller.GetTargets(dbClient, images))
+
+	// get price history of the style, query: from, to, interval
+	api.GET("/styles/:id/history",
+		middleware.Validate(middleware.StyleId),
+		middleware.Validate(middleware.QueryTimeRange),
+		middleware.Validate(middleware.QueryInterval),
+		controller.GetStyleHistory(dbClient))
 
 	// set up server
 	srv := &http.Server{
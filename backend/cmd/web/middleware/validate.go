@@ -2,41 +2,27 @@ package middleware
 
 import (
 	"fmt"
-	"log"
 	"net/http"
-	"regexp"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
+	"github.com/knchan0x/belle-maison/backend/internal/crawler"
+	"github.com/knchan0x/belle-maison/backend/internal/db/model/product"
 )
 
 const (
 	maxInt = 1<<31 - 1
-
-	productIdLength    = 7
-	pattern_product_id = "productId"
 )
 
-var patterns map[string]*regexp.Regexp
-
-func init() {
-	productIdPattern, err := regexp.Compile(`\d{7}`)
-	if err != nil {
-		log.Fatal("invalid regexp: productIdPattern")
-	}
-	patterns = map[string]*regexp.Regexp{pattern_product_id: productIdPattern}
-}
-
-func ValidateProductCode(code string) bool {
-	if len(patterns) == 0 {
-		log.Fatal("no pattern provided")
-	}
-
-	if code != "" && len(code) == productIdLength && patterns[pattern_product_id].MatchString(code) {
-		return true
-	}
-
-	return false
+// ValidateProductCode checks is the code valid for the site provided,
+// it returns false if the site is not supported.
+// Url of product page and sku are accepted as well.
+func ValidateProductCode(site, code string) bool {
+	_, err := crawler.NormalizeProductCode(site, code)
+	return err == nil
 }
 
 type ValidateType int
@@ -49,17 +35,33 @@ const (
 	TargetSize
 	TargetPrice
 	QueryPageSize
+	SearchQuery
+	CategoryId
+	QueryListingPage
+	QueryCategory
+	StyleId
+	QueryTimeRange
+	QueryInterval
 )
 
 const (
-	Validated_ProductCode  = "Validated_ProductCode"
-	Validated_ProductId    = "Validated_ProductId"
-	Validated_TargetId     = "Validated_TargetId"
-	Validated_TargetColour = "Validated_TargetColour"
-	Validated_TargetSize   = "Validated_TargetSize"
-	Validated_TargetPrice  = "Validated_TargetPrice"
-	Validated_QueryPage    = "Validated_QueryPage"
-	Validated_QuerySize    = "Validated_QuerySize"
+	Validated_Site          = "Validated_Site"
+	Validated_ProductCode   = "Validated_ProductCode"
+	Validated_StyleRef      = "Validated_StyleRef" // *crawler.ProductRef if style referred
+	Validated_ProductId     = "Validated_ProductId"
+	Validated_TargetId      = "Validated_TargetId"
+	Validated_TargetColour  = "Validated_TargetColour"
+	Validated_TargetSize    = "Validated_TargetSize"
+	Validated_TargetPrice   = "Validated_TargetPrice"
+	Validated_QueryPage     = "Validated_QueryPage"
+	Validated_QuerySize     = "Validated_QuerySize"
+	Validated_SearchQuery   = "Validated_SearchQuery"
+	Validated_CategoryId    = "Validated_CategoryId"
+	Validated_QueryCategory = "Validated_QueryCategory"
+	Validated_StyleId       = "Validated_StyleId"
+	Validated_QueryFrom     = "Validated_QueryFrom"
+	Validated_QueryTo       = "Validated_QueryTo"
+	Validated_QueryInterval = "Validated_QueryInterval"
 )
 
 // Validate processes handler after Validations completed
@@ -79,6 +81,20 @@ func Validate(t ValidateType) func(*gin.Context) {
 		return validateTargetPrice()
 	case QueryPageSize:
 		return validateQueryPageSize()
+	case SearchQuery:
+		return validateSearchQuery()
+	case CategoryId:
+		return validateCategoryId()
+	case QueryListingPage:
+		return validateQueryListingPage()
+	case QueryCategory:
+		return validateQueryCategory()
+	case StyleId:
+		return validateStyleId()
+	case QueryTimeRange:
+		return validateQueryTimeRange()
+	case QueryInterval:
+		return validateQueryInterval()
 	default:
 		return byPass()
 	}
@@ -90,14 +106,22 @@ func byPass() func(*gin.Context) {
 	}
 }
 
+// validateProductCode validates product code with the adapter of
+// the site provided in query "site", default site will be used if not provided.
+// Url of product page and sku are accepted, site of url is used.
 func validateProductCode() func(*gin.Context) {
 	return func(ctx *gin.Context) {
-		code := ctx.Param("productCode")
-		if !ValidateProductCode(code) {
+		site := ctx.DefaultQuery("site", crawler.DEFAULT_SITE)
+		ref, err := crawler.NormalizeProductCode(site, ctx.Param("productCode"))
+		if err != nil {
 			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "invalid id"}) // 404 Not Found -> ID Not Found
 			return
 		}
-		ctx.Set(Validated_ProductCode, code)
+		ctx.Set(Validated_Site, ref.Site)
+		ctx.Set(Validated_ProductCode, ref.ProductCode)
+		if ref.StyleCode != "" || ref.VariantID != "" {
+			ctx.Set(Validated_StyleRef, ref)
+		}
 		ctx.Next()
 	}
 }
@@ -147,20 +171,34 @@ func validateProductId() func(*gin.Context) {
 	}
 }
 
+// validateTargetColour requires "colour" unless style referred by product code
 func validateTargetColour() func(*gin.Context) {
 	return func(ctx *gin.Context) {
-		validatePostForm(ctx, "colour", Validated_TargetColour)
+		validateStylePostForm(ctx, "colour", Validated_TargetColour)
 		ctx.Next()
 	}
 }
 
+// validateTargetSize requires "size" unless style referred by product code
 func validateTargetSize() func(*gin.Context) {
 	return func(ctx *gin.Context) {
-		validatePostForm(ctx, "size", Validated_TargetSize)
+		validateStylePostForm(ctx, "size", Validated_TargetSize)
 		ctx.Next()
 	}
 }
 
+// validateStylePostForm is validatePostForm but item is optional if
+// style referred, i.e. sku provided, it must be used after validateProductCode
+func validateStylePostForm(ctx *gin.Context, item, ctxKey string) {
+	if _, ok := ctx.Get(Validated_StyleRef); ok {
+		if v, ok := ctx.GetPostForm(item); ok {
+			ctx.Set(ctxKey, v)
+		}
+		return
+	}
+	validatePostForm(ctx, item, ctxKey)
+}
+
 func validateTargetPrice() func(*gin.Context) {
 	return func(ctx *gin.Context) {
 		validatePostForm(ctx, "price", Validated_TargetPrice)
@@ -190,3 +228,149 @@ func validateQueryPageSize() gin.HandlerFunc {
 		ctx.Next()
 	}
 }
+
+const (
+	maxSearchQuery = 100 // characters
+)
+
+// validateSearchQuery validates query "q" and "site",
+// default site will be used if not provided
+func validateSearchQuery() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		q := strings.TrimSpace(ctx.Query("q"))
+		if q == "" || utf8.RuneCountInString(q) > maxSearchQuery {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid search query"})
+			return
+		}
+		ctx.Set(Validated_Site, ctx.DefaultQuery("site", crawler.DEFAULT_SITE))
+		ctx.Set(Validated_SearchQuery, q)
+		ctx.Next()
+	}
+}
+
+// validateCategoryId validates category id with the adapter of the site
+// provided in query "site", default site will be used if not provided
+func validateCategoryId() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		site := ctx.DefaultQuery("site", crawler.DEFAULT_SITE)
+		id := ctx.Param("categoryId")
+
+		adapter, _ := crawler.GetSiteAdapter(site)
+		lister, ok := adapter.(crawler.Lister)
+		if !ok || !lister.ValidateCategoryID(id) {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "invalid category id"})
+			return
+		}
+		ctx.Set(Validated_Site, site)
+		ctx.Set(Validated_CategoryId, id)
+		ctx.Next()
+	}
+}
+
+// validateQueryListingPage validates query "page" of listing, default: 1
+func validateQueryListingPage() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+		if err != nil || page <= 0 {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid page"})
+			return
+		}
+		ctx.Set(Validated_QueryPage, page)
+		ctx.Next()
+	}
+}
+
+const (
+	maxCategoryId = 50 // characters
+)
+
+// validateQueryCategory validates optional query "category",
+// category id of any level of the breadcrumb
+func validateQueryCategory() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		category, ok := ctx.GetQuery("category")
+		if !ok {
+			ctx.Next()
+			return
+		}
+		category = strings.TrimSpace(category)
+		if category == "" || len(category) > maxCategoryId {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid category"})
+			return
+		}
+		ctx.Set(Validated_QueryCategory, category)
+		ctx.Next()
+	}
+}
+
+func validateStyleId() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil || id <= 0 {
+			ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "invalid style id"})
+			return
+		}
+		ctx.Set(Validated_StyleId, id)
+		ctx.Next()
+	}
+}
+
+const (
+	defaultTimeRange = 90 * 24 * time.Hour
+	maxTimeRange     = 2 // years
+	dateLayout       = "2006-01-02"
+)
+
+// validateQueryTimeRange validates optional query "from" and "to", either
+// date, i.e. 2023-10-01, or RFC3339. Dates of "to" are included,
+// at most maxTimeRange years apart, default: the last 90 days until now.
+func validateQueryTimeRange() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		to, err := parseQueryTime(ctx.Query("to"), time.Now(), true)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid to"})
+			return
+		}
+		from, err := parseQueryTime(ctx.Query("from"), to.Add(-defaultTimeRange), false)
+		if err != nil || from.After(to) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid from"})
+			return
+		}
+		if from.Before(to.AddDate(-maxTimeRange, 0, 0)) {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("time range longer than %d years", maxTimeRange)})
+			return
+		}
+		ctx.Set(Validated_QueryFrom, from)
+		ctx.Set(Validated_QueryTo, to)
+		ctx.Next()
+	}
+}
+
+// parseQueryTime parses date in local time or RFC3339, date is
+// the end of the day if endOfDay, def returned if empty
+func parseQueryTime(v string, def time.Time, endOfDay bool) (time.Time, error) {
+	if v == "" {
+		return def, nil
+	}
+	if t, err := time.ParseInLocation(dateLayout, v, time.Local); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// validateQueryInterval validates optional query "interval" of downsampling,
+// daily or weekly, default: daily
+func validateQueryInterval() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		interval := ctx.DefaultQuery("interval", product.INTERVAL_DAILY)
+		if interval != product.INTERVAL_DAILY && interval != product.INTERVAL_WEEKLY {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid interval"})
+			return
+		}
+		ctx.Set(Validated_QueryInterval, interval)
+		ctx.Next()
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -66,7 +67,22 @@ func GetInt(key string) int {
 	return viper.GetInt(key)
 }
 
+// GetSizeInBytes returns the size associated with the key in bytes, i.e. "20MB".
+func GetSizeInBytes(key string) uint {
+	return viper.GetSizeInBytes(key)
+}
+
 // GetBool returns the value associated with the key as a boolean.
 func GetBool(key string) bool {
 	return viper.GetBool(key)
 }
+
+// GetFloat64 returns the value associated with the key as a float64.
+func GetFloat64(key string) float64 {
+	return viper.GetFloat64(key)
+}
+
+// GetDuration returns the value associated with the key as a time.Duration.
+func GetDuration(key string) time.Duration {
+	return viper.GetDuration(key)
+}
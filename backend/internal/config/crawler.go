@@ -0,0 +1,55 @@
+package config
+
+import (
+	"github.com/knchan0x/belle-maison/backend/internal/crawler"
+)
+
+// CrawlerSettings returns crawler settings under key "crawler",
+// defaults will be used for the items not provided
+func CrawlerSettings() *crawler.Settings {
+	return &crawler.Settings{
+		Concurrency: GetInt("crawler.concurrency"),
+		RateLimit:   GetFloat64("crawler.rate_limit"),
+		RateBurst:   GetInt("crawler.rate_burst"),
+		MaxParsers:  GetInt("crawler.max_parsers"),
+
+		RequestTimeout:  GetDuration("crawler.request_timeout"),
+		MaxResponseSize: int64(GetSizeInBytes("crawler.max_response_size")),
+
+		MaxRetries:     GetInt("crawler.retry.max_retries"),
+		RetryBaseDelay: GetDuration("crawler.retry.base_delay"),
+		RetryMaxDelay:  GetDuration("crawler.retry.max_delay"),
+
+		IgnoreRobots: GetBool("crawler.ignore_robots"),
+
+		ArchiveDir: GetString("crawler.archive_dir"),
+
+		CassetteMode: GetString("crawler.cassette.mode"),
+		CassetteDir:  GetString("crawler.cassette.dir"),
+
+		UserAgents: GetStringSlice("crawler.user_agents"),
+
+		Proxies:          GetStringSlice("crawler.proxy.urls"),
+		ProxyStrategy:    GetString("crawler.proxy.strategy"),
+		ProxyMaxFailures: GetInt("crawler.proxy.max_failures"),
+		ProxyCooldown:    GetDuration("crawler.proxy.cooldown"),
+
+		BreakerThreshold: GetInt("crawler.circuit_breaker.threshold"),
+		BreakerCooldown:  GetDuration("crawler.circuit_breaker.cooldown"),
+	}
+}
+
+// CrawlerOptions returns options of crawler.NewCrawler under key "crawler"
+func CrawlerOptions() []crawler.Option {
+	opts := []crawler.Option{
+		crawler.WithSettings(CrawlerSettings()),
+		crawler.WithTLSVerify(!GetBool("crawler.tls.insecure_skip_verify")),
+	}
+	if bundle := GetString("crawler.tls.ca_bundle"); bundle != "" {
+		opts = append(opts, crawler.WithCABundle(bundle))
+	}
+	if baseURL := GetString("crawler.base_url"); baseURL != "" {
+		opts = append(opts, crawler.WithBaseURL(baseURL))
+	}
+	return opts
+}
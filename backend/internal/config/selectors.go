@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/knchan0x/belle-maison/backend/internal/crawler"
+	"github.com/spf13/viper"
+)
+
+// LoadSelectors loads the selector file under key "crawler.selectors" and
+// applies it to the crawler, built-in selectors will be used if not provided.
+// The file is watched, changes take effect without restart and invalid
+// changes are ignored.
+func LoadSelectors() error {
+	path := GetString("crawler.selectors")
+	if path == "" {
+		return nil
+	}
+
+	// relative to config.yaml
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(viper.ConfigFileUsed()), path)
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read selector file: %v", err)
+	}
+	if err := applySelectors(v); err != nil {
+		return fmt.Errorf("invalid selector file %s: %v", path, err)
+	}
+
+	v.OnConfigChange(func(e fsnotify.Event) {
+		if err := applySelectors(v); err != nil {
+			log.Printf("Invalid selector file %s, changes ignored: %v", path, err)
+			return
+		}
+		log.Printf("Selector file %s reloaded", path)
+	})
+	v.WatchConfig()
+
+	return nil
+}
+
+func applySelectors(v *viper.Viper) error {
+	f := &crawler.SelectorFile{}
+	if err := v.UnmarshalExact(f); err != nil {
+		return err
+	}
+	return crawler.ApplySelectors(f)
+}
@@ -0,0 +1,118 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	snapshotTimeFormat = "20060102T150405Z"
+	snapshotExt        = ".html.gz"
+)
+
+// Archive stores raw pages fetched on disk, gzipped and keyed by
+// product code and timestamp: <dir>/<site>/<product code>/<timestamp>.html.gz
+type Archive struct {
+	dir string
+}
+
+// Snapshot is a page stored in Archive
+type Snapshot struct {
+	Site        string
+	ProductCode string
+	Time        time.Time
+	Path        string
+}
+
+// NewArchive returns Archive stores pages under dir
+func NewArchive(dir string) *Archive {
+	return &Archive{dir: dir}
+}
+
+// Save saves page of the product fetched at the time provided
+func (a *Archive) Save(site, productCode string, at time.Time, html []byte) error {
+	dir := filepath.Join(a.dir, site, productCode)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(html); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	name := at.UTC().Format(snapshotTimeFormat) + snapshotExt
+	return os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0644)
+}
+
+// Snapshots returns snapshots of the site and product code provided
+// in chronological order, all sites or products will be included if empty
+func (a *Archive) Snapshots(site, productCode string) ([]Snapshot, error) {
+	if site == "" {
+		site = "*"
+	}
+	if productCode == "" {
+		productCode = "*"
+	}
+
+	paths, err := filepath.Glob(filepath.Join(a.dir, site, productCode, "*"+snapshotExt))
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []Snapshot{}
+	for _, path := range paths {
+		at, err := time.Parse(snapshotTimeFormat, strings.TrimSuffix(filepath.Base(path), snapshotExt))
+		if err != nil {
+			continue // not a snapshot
+		}
+		dir := filepath.Dir(path)
+		snapshots = append(snapshots, Snapshot{
+			Site:        filepath.Base(filepath.Dir(dir)),
+			ProductCode: filepath.Base(dir),
+			Time:        at,
+			Path:        path,
+		})
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+	return snapshots, nil
+}
+
+// Load returns the page stored
+func (s *Snapshot) Load() ([]byte, error) {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	return io.ReadAll(zr)
+}
+
+// Parse parses the page stored with the current parser of its site
+func (s *Snapshot) Parse() *Result {
+	html, err := s.Load()
+	if err != nil {
+		return &Result{Site: s.Site, ProductCode: s.ProductCode, Err: err, Class: Classify(err)}
+	}
+	return ParsePage(s.Site, s.ProductCode, html)
+}
@@ -0,0 +1,423 @@
+package crawler
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	baseURL = "https://www.bellemaison.jp/shop/commodity/0000/"
+)
+
+var (
+	productCodePattern = regexp.MustCompile(`^\d{7}$`)
+	skuPattern         = regexp.MustCompile(`^(\d{7})(\d{5})$`) // product code + style code
+	variantIDPattern   = regexp.MustCompile(`^\d+$`)
+)
+
+// bellemaison implements SiteAdapter interface for www.bellemaison.jp
+type bellemaison struct {
+	selectors atomic.Pointer[Selectors]
+}
+
+func newBellemaison() *bellemaison {
+	b := &bellemaison{}
+	b.selectors.Store(DefaultSelectors())
+	return b
+}
+
+// DefaultSelectors returns selectors of www.bellemaison.jp used if no selector file provided
+func DefaultSelectors() *Selectors {
+	return &Selectors{
+		NotFoundTitle: "h1[class='title']",
+		NotFoundText:  "お探しの商品が見つかりません",
+		ProductName:   "h1[class='product-name text-weight-bold']",
+
+		StructuredData: "script[type='application/ld+json']",
+		Maintenance:    []PageMarker{{Selector: "title", Text: "メンテナンス中"}},
+		Description:    ".product-spec-block .spec-list",
+		Breadcrumb:     ".genre-breadcrumbs a",
+		Points:         ".campaign-box-header .text-warning",
+		StyleArea:      "#commodityStandardAreaMessage",
+		Style:          ".standard-info",
+		Attributes: StyleAttributes{
+			Colour:     "data-standard-detail2",
+			Size:       "data-standard-detail1",
+			SizeDetail: "data-standard-detail12",
+			Sku:        "data-nucleus-sku-code",
+			VariantID:  "id",
+			Price:      "data-price",
+			ListPrice:  "", // not on pages saved yet, sale and outlet are, see test/success.html
+			Sale:       "data-sale",
+			Outlet:     "data-outlet",
+			Stock:      "data-stock-status",
+		},
+		ColourOptions: []string{
+			".variation-list_item input[name='color']",
+			".variation-check-radio input[name='color']",
+		},
+		ColourOptionName:  "data-name",
+		ColourOptionImage: "data-img",
+		ImageFallback:     "https://pic2.bellemaison.jp/shop/cms/images/0000/catalog/{productCode}/{productCode}_h1_001.jpg",
+		// to be verified with a listing page saved from the site, see test/listing.html,
+		// listings of no item are rejected until then
+		Listing: ListingSelectors{
+			Item:     ".item-list .item",
+			Link:     "a.item-link",
+			Name:     ".item-name",
+			Price:    ".item-price",
+			Image:    "img.item-image",
+			NextPage: ".pager .next a",
+		},
+	}
+}
+
+func (b *bellemaison) Name() string {
+	return BELLE_MAISON
+}
+
+func (b *bellemaison) ProductURL(productCode string) string {
+	return baseURL + productCode
+}
+
+// ValidateProductCode accepts 7 digits product code only
+func (b *bellemaison) ValidateProductCode(productCode string) bool {
+	return productCodePattern.MatchString(productCode)
+}
+
+// Normalize accepts product code, sku, i.e. 112925001001, and url of product page,
+// i.e. https://www.bellemaison.jp/shop/commodity/0000/1129250?s=100000000001112118
+func (b *bellemaison) Normalize(input string) (*ProductRef, bool) {
+	if productCodePattern.MatchString(input) {
+		return &ProductRef{ProductCode: input}, true
+	}
+	if m := skuPattern.FindStringSubmatch(input); m != nil {
+		return &ProductRef{ProductCode: m[1], StyleCode: m[2]}, true
+	}
+
+	if !strings.Contains(input, "://") {
+		input = "https://" + input
+	}
+	u, err := url.Parse(input)
+	if err != nil || u.Hostname() != "bellemaison.jp" && !strings.HasSuffix(u.Hostname(), ".bellemaison.jp") {
+		return nil, false
+	}
+	m := productLinkPattern.FindStringSubmatch(u.Path)
+	if m == nil {
+		return nil, false
+	}
+
+	ref := &ProductRef{ProductCode: m[1]}
+	if s := u.Query().Get("s"); variantIDPattern.MatchString(s) {
+		ref.VariantID = s
+	}
+	return ref, true
+}
+
+func (b *bellemaison) ParseHTML(html []byte) (*Product, error) {
+	return parseHTML(html, b.Selectors())
+}
+
+// Selectors returns selectors in use
+func (b *bellemaison) Selectors() *Selectors {
+	return b.selectors.Load()
+}
+
+// SetSelectors replaces selectors in use, it is safe to call during parsing
+func (b *bellemaison) SetSelectors(selectors *Selectors) {
+	b.selectors.Store(selectors)
+}
+
+var (
+	PRODUCT_NOT_FOUND = errors.New("Product Not Found")
+)
+
+// parseHTML converts html page to Product struct
+func parseHTML(html []byte, sel *Selectors) (*Product, error) {
+
+	page, err := goquery.NewDocumentFromReader(bytes.NewReader(html))
+	if err != nil {
+		return nil, err
+	}
+
+	// i.e. maintenance page
+	if err := detectBlockedBy(page, sel); err != nil {
+		return nil, err
+	}
+
+	title := ""
+	page.Find(sel.NotFoundTitle).Each(func(i int, s *goquery.Selection) {
+		title = s.Text()
+	})
+
+	// product has been removed
+	if title == sel.NotFoundText {
+		return nil, PRODUCT_NOT_FOUND
+	}
+
+	extractors := []Extractor{}
+	if sel.StructuredData != "" {
+		extractors = append(extractors, Extractor{
+			Name:    EXTRACTOR_JSONLD,
+			Extract: func(page *goquery.Document) (*Product, error) { return extractJSONLD(page, sel) },
+		})
+	}
+	extractors = append(extractors, Extractor{
+		Name:    EXTRACTOR_DOM,
+		Extract: func(page *goquery.Document) (*Product, error) { return extractDOM(page, sel) },
+	})
+
+	return Extract(page, extractors...)
+}
+
+// extractJSONLD extracts product from schema.org Product objects, one object
+// per sku. Discount is not provided, neither colour and size unless the
+// objects have color and size.
+func extractJSONLD(page *goquery.Document, sel *Selectors) (*Product, error) {
+	newProduct := &Product{
+		Styles: []Style{},
+	}
+
+	objects := ldObjectsOf(page, sel.StructuredData, "Product")
+	skus := []ldObject{}
+	availability := ""
+	for _, obj := range objects {
+		if obj.str("sku") == "" {
+			// product itself
+			newProduct.Name = obj.str("name")
+			newProduct.Brand = ldBrand(obj)
+			newProduct.Description = htmlText(obj.str("description"))
+			availability = obj.obj("offers").str("availability")
+			continue
+		}
+		skus = append(skus, obj)
+	}
+
+	for _, obj := range skus {
+		sku := obj.str("sku")
+		if len(sku) <= 7 {
+			continue
+		}
+
+		offer := obj.obj("offers")
+		price, err := parsePrice(offer.str("price"))
+		if err != nil {
+			continue
+		}
+
+		// availability of the product is the one of the sku if it is the only one
+		stock := ldAvailability(offer.str("availability"))
+		if !stock.known() && len(skus) == 1 {
+			stock = ldAvailability(availability)
+		}
+
+		fillString(&newProduct.Name, obj.str("name"))
+		fillString(&newProduct.Brand, ldBrand(obj))
+		fillString(&newProduct.Description, htmlText(obj.str("description")))
+		// i.e. https://www.bellemaison.jp/shop/commodity/0000/1129250?s=100000000001112118
+		variantID := ""
+		if u, err := url.Parse(offer.str("url")); err == nil {
+			variantID = u.Query().Get("s")
+		}
+
+		newProduct.Styles = append(newProduct.Styles, Style{
+			StyleCode: sku[7:],
+			VariantID: variantID,
+			ImageUrl:  obj.str("image"),
+			Colour:    obj.str("color"),
+			Size:      obj.str("size"),
+			Price:     price,
+			RawPrice:  offer.str("price"),
+			Stock:     stock,
+		})
+	}
+
+	newProduct.Specs = parseSpecs(newProduct.Description)
+	newProduct.Breadcrumb = ldBreadcrumb(page, sel.StructuredData, categoryID)
+
+	return newProduct, nil
+}
+
+// extractDOM extracts product from the attributes of styles
+func extractDOM(page *goquery.Document, sel *Selectors) (*Product, error) {
+	newProduct := &Product{
+		Styles: []Style{},
+	}
+
+	// get product name
+	page.Find(sel.ProductName).Each(func(i int, s *goquery.Selection) {
+		if i == 0 {
+			newProduct.Name = s.Text()
+		}
+	})
+
+	extractDetails(newProduct, page, sel, categoryID)
+
+	// points rewarded, same for all styles
+	points := uint(0)
+	if sel.Points != "" {
+		page.Find(sel.Points).Each(func(i int, s *goquery.Selection) {
+			if i == 0 {
+				points, _ = parsePrice(strings.TrimSuffix(strings.TrimSpace(s.Text()), "ポイント"))
+			}
+		})
+	}
+
+	// find the target items
+	attr := sel.Attributes
+	var colour, size, current, stock, sku string
+	page.Find(sel.StyleArea).Parent().Each(func(i int, s *goquery.Selection) {
+		s.Find(sel.Style).Each(func(i int, s *goquery.Selection) {
+
+			colour, _ = s.Attr(attr.Colour)
+			// check colour info
+			if colour == "-" {
+				colour = "Standard"
+			}
+
+			size, _ = s.Attr(attr.Size)
+			// check size info
+			if size == "-" {
+				size = "Standard"
+			}
+
+			// in case it has additional size info
+			if detail, exist := s.Attr(attr.SizeDetail); exist {
+				if detail != "-" {
+					size = size + "/" + detail
+				}
+			}
+
+			sku, _ = s.Attr(attr.Sku)
+			if len(sku) <= 7 {
+				return // style code missing
+			}
+			variantID := s.AttrOr(attr.VariantID, "")
+
+			current, _ = s.Attr(attr.Price)
+			currentPrice, err := parsePrice(current)
+			if err != nil {
+				currentPrice = 0 // rejected by RejectImplausible
+			}
+
+			// list price is only available when discounted
+			regularPrice := currentPrice
+			if listPrice, exist := s.Attr(attr.ListPrice); exist {
+				if p, err := parsePrice(listPrice); err == nil && p > currentPrice {
+					regularPrice = p
+				}
+			}
+
+			salePrice := uint(0)
+			if s.AttrOr(attr.Sale, "false") == "true" || s.AttrOr(attr.Outlet, "false") == "true" || regularPrice > currentPrice {
+				salePrice = currentPrice
+			}
+
+			stock, _ = s.Attr(attr.Stock)
+			stockStatus := parseStock(stock, time.Now())
+
+			image := ""
+			for _, option := range sel.ColourOptions {
+				s.Siblings().Find(option).Each(func(i int, s *goquery.Selection) {
+					itemColor, _ := s.Attr(sel.ColourOptionName)
+					if colour == itemColor {
+						image, _ = s.Attr(sel.ColourOptionImage)
+					}
+				})
+				if image != "" {
+					break
+				}
+			}
+
+			if image == "" {
+				image = strings.ReplaceAll(sel.ImageFallback, "{productCode}", sku[:7])
+			}
+
+			newStyle := Style{
+				StyleCode:    sku[7:],
+				VariantID:    variantID,
+				ImageUrl:     image,
+				Colour:       colour,
+				Size:         size,
+				Price:        currentPrice,
+				RawPrice:     current,
+				RegularPrice: regularPrice,
+				SalePrice:    salePrice,
+				Discount:     discount(regularPrice, currentPrice),
+				Points:       points,
+				Stock:        stockStatus,
+			}
+			newProduct.Styles = append(newProduct.Styles, newStyle)
+		})
+	})
+
+	return newProduct, nil
+}
+
+// parsePrice parses price with thousands separator, i.e. "6,578"
+func parsePrice(price string) (uint, error) {
+	p, err := strconv.ParseUint(strings.ReplaceAll(strings.TrimSpace(price), ",", ""), 10, 64)
+	return uint(p), err
+}
+
+// discount returns discount in percent, rounded to the nearest integer
+func discount(regularPrice, price uint) uint {
+	if regularPrice == 0 || price >= regularPrice {
+		return 0
+	}
+	return ((regularPrice-price)*100 + regularPrice/2) / regularPrice
+}
+
+var restockDatePattern = regexp.MustCompile(`(?:(\d{4})年)?(\d{1,2})月(\d{1,2})日`)
+
+// parseStock converts stock description to StockStatus,
+// restock date without year is considered as the nearest date from now
+func parseStock(description string, now time.Time) StockStatus {
+	switch description {
+	case "在庫あり":
+		return StockStatus{State: InStock}
+	case "売り切れ":
+		return StockStatus{State: SoldOut}
+	case "販売停止", "売り切れ（再入荷なし）":
+		return StockStatus{State: Discontinued}
+	}
+
+	if strings.Contains(description, "在庫：") {
+		temp := strings.Split(description, "：")
+		tempNo, err := strconv.ParseUint(strings.TrimSpace(temp[1]), 10, 64)
+		if err == nil && tempNo > 0 {
+			return StockStatus{State: LowStock, Quantity: uint(tempNo)}
+		}
+		return StockStatus{State: SoldOut}
+	}
+
+	if strings.Contains(description, "入荷予定") {
+		status := StockStatus{State: Backorder}
+		if m := restockDatePattern.FindStringSubmatch(description); m != nil {
+			month, _ := strconv.Atoi(m[2])
+			day, _ := strconv.Atoi(m[3])
+			year := now.Year()
+			if m[1] != "" {
+				year, _ = strconv.Atoi(m[1])
+			}
+
+			date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, now.Location())
+			// i.e. restock on 1/10 announced in December
+			if m[1] == "" && date.Before(now.AddDate(0, -6, 0)) {
+				date = date.AddDate(1, 0, 0)
+			}
+			status.ExpectedDate = &date
+		}
+		return status
+	}
+
+	return StockStatus{State: UnknownStock}
+}
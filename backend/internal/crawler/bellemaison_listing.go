@@ -0,0 +1,112 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	listingURL = "https://www.bellemaison.jp/shop/app/catalog/list/"
+)
+
+var (
+	categoryIDPattern   = regexp.MustCompile(`^\d{1,10}$`)
+	productLinkPattern  = regexp.MustCompile(`/commodity/\d{4}/(\d{7})`)
+	listingPricePattern = regexp.MustCompile(`\d[\d,]*`)
+	categoryLinkPattern = regexp.MustCompile(`(?:[?&]categoryList=|/category_top/)(\d+)(?:$|[&/#])`)
+)
+
+// SearchURL uses "keyword", the search box in the header of the site,
+// "page" is not verified yet, see test/listing.html
+func (b *bellemaison) SearchURL(query string, page int) string {
+	return fmt.Sprintf("%s?keyword=%s&page=%d", listingURL, url.QueryEscape(query), page)
+}
+
+// CategoryURL uses "categoryList", the same as links of breadcrumb
+func (b *bellemaison) CategoryURL(categoryID string, page int) string {
+	return fmt.Sprintf("%s?categoryList=%s&page=%d", listingURL, url.QueryEscape(categoryID), page)
+}
+
+// ValidateCategoryID accepts digits only, i.e. 1009 or 100901 for sub-category
+func (b *bellemaison) ValidateCategoryID(categoryID string) bool {
+	return categoryIDPattern.MatchString(categoryID)
+}
+
+func (b *bellemaison) ParseListing(html []byte) (*Listing, error) {
+	return parseListing(html, b.Selectors())
+}
+
+// parseListing converts listing page to Listing struct, items without link
+// to product page are ignored. *BlockedError is returned if it is a maintenance,
+// captcha or anti-bot page, *DriftError if no item found, as markup of empty
+// listing is not known, an empty listing is most likely selectors not matched.
+func parseListing(html []byte, selectors *Selectors) (*Listing, error) {
+	sel := &selectors.Listing
+	if sel.Item == "" {
+		return nil, ErrListingNotSupported
+	}
+
+	page, err := goquery.NewDocumentFromReader(bytes.NewReader(html))
+	if err != nil {
+		return nil, err
+	}
+	if err := detectBlockedBy(page, selectors); err != nil {
+		return nil, err
+	}
+
+	listing := &Listing{
+		Products: []ListingItem{},
+	}
+
+	page.Find(sel.Item).Each(func(i int, s *goquery.Selection) {
+		href, _ := s.Find(sel.Link).Attr("href")
+		m := productLinkPattern.FindStringSubmatch(href)
+		if m == nil {
+			return
+		}
+
+		item := ListingItem{
+			ProductCode: m[1],
+		}
+		if sel.Name != "" {
+			item.Name = strings.TrimSpace(s.Find(sel.Name).First().Text())
+		}
+		if sel.Price != "" {
+			// i.e. "6,578円（税込）", the lowest one if range is shown
+			if price := listingPricePattern.FindString(s.Find(sel.Price).First().Text()); price != "" {
+				item.Price, _ = parsePrice(price)
+			}
+		}
+		if sel.Image != "" {
+			img := s.Find(sel.Image).First()
+			item.ImageUrl = img.AttrOr("data-src", img.AttrOr("src", ""))
+		}
+		listing.Products = append(listing.Products, item)
+	})
+
+	if len(listing.Products) == 0 {
+		if err := detectBlocked(html); err != nil {
+			return nil, err
+		}
+		return nil, &DriftError{Reason: "no item found in listing"}
+	}
+
+	if sel.NextPage != "" {
+		listing.HasNext = page.Find(sel.NextPage).Length() > 0
+	}
+	return listing, nil
+}
+
+// categoryID returns category id of the link to category page, i.e.
+// /shop/app/catalog/list/?categoryList=1009, or empty if not matched
+func categoryID(link string) string {
+	if m := categoryLinkPattern.FindStringSubmatch(link); m != nil {
+		return m[1]
+	}
+	return ""
+}
@@ -0,0 +1,104 @@
+package crawler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	ErrMaintenance = errors.New("site under maintenance")
+	ErrBotBlocked  = errors.New("blocked as bot")
+	ErrCaptcha     = errors.New("captcha required")
+)
+
+// BlockedError is returned when the site served a maintenance page,
+// an anti-bot page or a captcha instead of the page requested
+type BlockedError struct {
+	URL        string
+	StatusCode int           // status of the response
+	RetryAfter time.Duration // value of Retry-After header, if any
+	Reason     error         // ErrMaintenance, ErrBotBlocked or ErrCaptcha
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("fetch %s: %v", e.URL, e.Reason)
+}
+
+func (e *BlockedError) Unwrap() error {
+	return e.Reason
+}
+
+// Class is Transient as the page will be served later,
+// the host is paused by the circuit breaker meanwhile
+func (e *BlockedError) Class() ErrorClass {
+	return Transient
+}
+
+// PageMarker matches pages having element of Selector,
+// of which text contains Text if provided
+type PageMarker struct {
+	Selector string `mapstructure:"selector"`
+	Text     string `mapstructure:"text"`
+}
+
+func (m PageMarker) match(page *goquery.Document) bool {
+	found := false
+	page.Find(m.Selector).EachWithBreak(func(i int, s *goquery.Selection) bool {
+		found = m.Text == "" || strings.Contains(s.Text(), m.Text)
+		return !found
+	})
+	return found
+}
+
+// detectBlockedBy returns *BlockedError if any of the markers of
+// the selectors matches, markers of maintenance are checked first
+func detectBlockedBy(page *goquery.Document, sel *Selectors) error {
+	for _, check := range []struct {
+		markers []PageMarker
+		reason  error
+	}{
+		{sel.Maintenance, ErrMaintenance},
+		{sel.Captcha, ErrCaptcha},
+		{sel.BotBlock, ErrBotBlocked},
+	} {
+		for _, marker := range check.markers {
+			if marker.match(page) {
+				return &BlockedError{Reason: check.reason}
+			}
+		}
+	}
+	return nil
+}
+
+// blockMarkers are fragments of html of well-known captcha and
+// anti-bot pages, only checked when the page is not the one expected
+var blockMarkers = []struct {
+	marker string
+	reason error
+}{
+	{`class="g-recaptcha"`, ErrCaptcha},
+	{`class="h-captcha"`, ErrCaptcha},
+	{`class="cf-turnstile"`, ErrCaptcha},
+	{`id="challenge-form"`, ErrCaptcha},             // cloudflare
+	{`captcha-delivery.com`, ErrCaptcha},            // datadome
+	{`<title>Just a moment...</title>`, ErrCaptcha}, // cloudflare
+	{`Attention Required! | Cloudflare`, ErrBotBlocked},
+	{`<title>Access Denied</title>`, ErrBotBlocked}, // akamai
+	{`Incapsula incident ID`, ErrBotBlocked},
+}
+
+// detectBlocked returns *BlockedError if html looks like
+// a well-known captcha or anti-bot page
+func detectBlocked(html []byte) error {
+	for _, m := range blockMarkers {
+		if bytes.Contains(html, []byte(m.marker)) {
+			return &BlockedError{Reason: m.reason}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitOpenError is returned without sending request while
+// the host is paused by the circuit breaker
+type CircuitOpenError struct {
+	Host  string
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s paused until %s: %v", e.Host, e.Until.Format(time.RFC3339), ErrCircuitOpen)
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// Class is Transient as the request has not been sent
+func (e *CircuitOpenError) Class() ErrorClass {
+	return Transient
+}
+
+// circuitBreaker pauses requests to a host for cooldown after it served
+// a blocked page, or failed threshold times in a row with transient errors
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	hosts     map[string]*circuit
+}
+
+type circuit struct {
+	failures  int       // transient failures in a row
+	openUntil time.Time // requests fail fast until
+}
+
+// newCircuitBreaker returns nil if threshold < 0, i.e. disabled
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold < 0 {
+		return nil
+	}
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		hosts:     make(map[string]*circuit),
+	}
+}
+
+// allow returns *CircuitOpenError if the host is paused
+func (b *circuitBreaker) allow(host string, now time.Time) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c, ok := b.hosts[host]; ok && now.Before(c.openUntil) {
+		return &CircuitOpenError{Host: host, Until: c.openUntil}
+	}
+	return nil
+}
+
+// report records result of a request to the host. Blocked pages open the
+// circuit at once, other transient errors once threshold reached in a row.
+// After cooldown, the circuit opens again on the next failure.
+func (b *circuitBreaker) report(host string, err error, now time.Time) {
+	if b == nil || errors.Is(err, ErrCircuitOpen) {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.hosts[host]
+	if !ok {
+		c = &circuit{}
+		b.hosts[host] = c
+	}
+
+	var blocked *BlockedError
+	switch {
+	case Classify(err) != Transient:
+		// succeeded or the site answered
+		c.failures = 0
+		return
+	case errors.As(err, &blocked):
+		c.failures = b.threshold
+	default:
+		c.failures++
+	}
+
+	if c.failures >= b.threshold && !now.Before(c.openUntil) {
+		cooldown := b.cooldown
+		if blocked != nil && blocked.RetryAfter > cooldown {
+			cooldown = blocked.RetryAfter
+		}
+		c.openUntil = now.Add(cooldown)
+		c.failures = b.threshold - 1 // half open after cooldown
+	}
+}
@@ -0,0 +1,158 @@
+package crawler
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+const (
+	CASSETTE_RECORD = "record"
+	CASSETTE_REPLAY = "replay"
+)
+
+var ErrNotRecorded = errors.New("response not recorded")
+
+// cassette keeps responses recorded under dir, one file per request
+type cassette struct {
+	dir string
+}
+
+// episode is a response recorded
+type episode struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// conditionalHeaders are part of the key, so 304 recorded for
+// conditional requests never replaces the page recorded
+var conditionalHeaders = []string{"If-None-Match", "If-Modified-Since"}
+
+// path returns file path of the request, keyed by method, url and
+// conditional headers, unconditional if not conditional
+func (c *cassette) path(req *http.Request, conditional bool) string {
+	key := req.Method + " " + req.URL.String()
+	if conditional {
+		for _, name := range conditionalHeaders {
+			key += "\n" + name + ": " + req.Header.Get(name)
+		}
+	}
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// isConditional returns true if any conditional header is set
+func isConditional(req *http.Request) bool {
+	for _, name := range conditionalHeaders {
+		if req.Header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// recorder implements HTTPClient, it sends requests with
+// the client provided and saves the responses to cassette
+type recorder struct {
+	cassette
+	client HTTPClient
+}
+
+// NewRecorder returns HTTPClient saves responses received by client to dir
+func NewRecorder(dir string, client HTTPClient) (HTTPClient, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &recorder{cassette: cassette{dir: dir}, client: client}, nil
+}
+
+func (r *recorder) Do(req *http.Request) (*http.Response, error) {
+	res, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(&episode{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		Body:       body,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(r.path(req, isConditional(req)), data, 0644); err != nil {
+		return nil, err
+	}
+
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	return res, nil
+}
+
+// replayer implements HTTPClient, it serves responses
+// from cassette without network access
+type replayer struct {
+	cassette
+}
+
+// NewReplayer returns HTTPClient serves responses recorded under dir
+func NewReplayer(dir string) (HTTPClient, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &replayer{cassette: cassette{dir: dir}}, nil
+}
+
+// Do serves conditional requests not recorded with
+// the response recorded for the unconditional one
+func (r *replayer) Do(req *http.Request) (*http.Response, error) {
+	conditional := isConditional(req)
+	data, err := os.ReadFile(r.path(req, conditional))
+	if conditional && errors.Is(err, os.ErrNotExist) {
+		data, err = os.ReadFile(r.path(req, false))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL, ErrNotRecorded)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	e := episode{}
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}, nil
+}
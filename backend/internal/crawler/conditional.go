@@ -0,0 +1,61 @@
+package crawler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+)
+
+// validator keeps what is needed to tell whether a product page has changed
+type validator struct {
+	ETag         string
+	LastModified string
+	Hash         string   // hash of the product parsed
+	Product      *Product // product parsed last time
+}
+
+// validator returns validator of the product code, nil if not available
+func (c *crawler) validator(code string) *validator {
+	if v, ok := c.validators.Get(code); ok {
+		return v.(*validator)
+	}
+	return nil
+}
+
+// Invalidate removes stored ETag, Last-Modified and content hash of products,
+// the next request of them will be reported as changed
+func (c *crawler) Invalidate(productCodes ...string) {
+	for _, code := range productCodes {
+		site, id := SplitCode(code)
+		c.validators.Delete(JoinCode(site, id))
+	}
+}
+
+// setHeaders adds conditional request headers
+func (v *validator) setHeaders(h http.Header) {
+	if v == nil {
+		return
+	}
+	if v.ETag != "" {
+		h.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		h.Set("If-Modified-Since", v.LastModified)
+	}
+}
+
+// hashProduct returns sha256 of the product parsed,
+// so changes of markup not related to the product are ignored
+func hashProduct(p *Product) string {
+	// same product found by another extractor
+	product := *p
+	product.Extractor = ""
+
+	data, err := json.Marshal(&product)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
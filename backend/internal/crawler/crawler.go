@@ -2,302 +2,581 @@ package crawler
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
-	"strconv"
-	"strings"
+	"net/url"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/PuerkitoBio/goquery"
+	"github.com/knchan0x/belle-maison/backend/internal/cache"
 )
 
 const (
+	// USER_AGENT is used if no user agents configured
 	USER_AGENT = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/98.0.4758.102 Safari/537.36"
-	baseURL    = "https://www.bellemaison.jp/shop/commodity/0000/"
 )
 
 type Result struct {
+	Site        string
 	ProductCode string
 	Product     *Product
 	Err         error
+	Class       ErrorClass // class of Err, NoError if succeeded
+	Unchanged   bool       // product is the same as last time it was fetched
 }
 
 type Product struct {
-	Name   string
-	Styles []Style
+	Name        string
+	Brand       string
+	Description string
+	Breadcrumb  []Category // from top level category
+	Specs       []Spec     // i.e. size, material
+	Styles      []Style
+	Extractor   string // extractor the product found by, i.e. EXTRACTOR_JSONLD
+}
+
+type Category struct {
+	ID   string
+	Name string
+}
+
+type Spec struct {
+	Name  string // empty if not named
+	Value string
 }
 
 type Style struct {
-	StyleCode string
-	ImageUrl  string
-	Colour    string
-	Size      string
-	Price     uint
-	Stock     uint
+	StyleCode    string
+	VariantID    string // id of the style in url of product page
+	ImageUrl     string
+	Colour       string
+	Size         string
+	Price        uint   // current price
+	RawPrice     string // price as on the page, kept for debugging
+	Rejected     string // reason the observation is implausible, i.e. REJECT_ZERO_PRICE, empty if accepted
+	RegularPrice uint   // price before discount
+	SalePrice    uint   // 0 if not on sale
+	Discount     uint   // discount in percent
+	Points       uint   // loyalty points rewarded
+	Stock        StockStatus
 }
 
 // Crawler
+//
+// Product codes accepted are either bare product codes of DEFAULT_SITE
+// or codes qualified by site, see JoinCode.
 type Crawler interface {
 	Scraping(productCodes ...string) []*Result
+	// ScrapingContext stops dispatching requests once ctx is done,
+	// products not fetched will be returned with ctx.Err()
+	ScrapingContext(ctx context.Context, productCodes ...string) []*Result
+	// Stream sends each result as soon as it is parsed,
+	// the channel will be closed once all products are done.
+	// Consumers must drain the channel.
+	Stream(ctx context.Context, productCodes ...string) <-chan *Result
+	// Search returns a page of search result of the site, page starts from 1.
+	// ErrListingNotSupported will be returned if the site is not a Lister.
+	Search(ctx context.Context, site, query string, page int) (*Listing, error)
+	// Category returns a page of category of the site, page starts from 1
+	Category(ctx context.Context, site, categoryID string, page int) (*Listing, error)
+	// Invalidate forgets what was fetched last time,
+	// so the products will not be reported as unchanged
+	Invalidate(productCodes ...string)
+	// Client returns http client sends GET requests the way the crawler does,
+	// i.e. through proxies, rate limited, robots.txt respected and recorded
+	Client() HTTPClient
 }
 
 // crawler implements Crawler interface
 type crawler struct {
 	httpClient HTTPClient
+	settings   Settings
+	options    *options
+	limiter    *hostLimiter
+	validators cache.Cache     // *validator of each product code
+	archive    *Archive        // nil if pages are not archived
+	requests   uint64          // requests sent, to rotate user agents
+	robots     *robotsCache    // nil if robots.txt is ignored
+	breaker    *circuitBreaker // nil if disabled
+	drops      *styleDrops
 }
 
 type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
-var ErrMultipleClient = errors.New("more than one http client assigned")
+var (
+	ErrMultipleClient   = errors.New("more than one http client assigned")
+	ErrResponseTooLarge = errors.New("response too large")
+)
 
-// NewCrawler return a Crawler instance,
-// default http client will be used if no httpClient provided
-func NewCrawler(httpClient ...HTTPClient) (Crawler, error) {
-	if len(httpClient) > 1 {
-		return nil, ErrMultipleClient
+// NewCrawler return a Crawler instance configured by opts,
+// DefaultSettings and default http client will be used if not provided
+func NewCrawler(opts ...Option) (Crawler, error) {
+	o := &options{settings: DefaultSettings().withDefaults()}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
 	}
+	for _, override := range o.overrides {
+		override(&o.settings)
+	}
+	s := o.settings
 
-	var client HTTPClient
-	if len(httpClient) == 0 {
-		client = &http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			},
-			Timeout: time.Second * 60,
+	client := o.httpClient
+	if client == nil {
+		if o.skipVerify {
+			log.Println("crawler: certificate verification is turned off")
+		}
+		transport := &http.Transport{
+			TLSClientConfig: o.tlsConfig(),
+		}
+		client = &http.Client{Transport: transport} // deadline set per request
+
+		if len(s.Proxies) > 0 {
+			pool, err := newProxyPool(s.Proxies, s.ProxyStrategy, s.ProxyMaxFailures, s.ProxyCooldown)
+			if err != nil {
+				return nil, err
+			}
+			transport.Proxy = proxyOf
+			client = &proxyClient{client: client, pool: pool}
 		}
-	} else {
-		client = httpClient[0]
 	}
 
-	return &crawler{httpClient: client}, nil
+	// record / replay responses for offline development
+	var err error
+	switch s.CassetteMode {
+	case CASSETTE_RECORD:
+		client, err = NewRecorder(s.CassetteDir, client)
+	case CASSETTE_REPLAY:
+		client, err = NewReplayer(s.CassetteDir)
+	case "":
+	default:
+		err = fmt.Errorf("unknown cassette mode: %s", s.CassetteMode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, wrap := range o.wrappers {
+		client = wrap(client)
+	}
+
+	c := &crawler{
+		httpClient: client,
+		settings:   s,
+		options:    o,
+		limiter:    newHostLimiter(s.RateLimit, s.RateBurst),
+		validators: cache.New(cache.IN_MEMORY),
+		breaker:    newCircuitBreaker(s.BreakerThreshold, s.BreakerCooldown),
+		drops:      newStyleDrops(),
+	}
+	if s.ArchiveDir != "" {
+		c.archive = NewArchive(s.ArchiveDir)
+	}
+	// nothing sent to the site when replaying
+	if !s.IgnoreRobots && s.CassetteMode != CASSETTE_REPLAY {
+		c.robots = newRobotsCache()
+	}
+	return c, nil
 }
 
 // http response
 type response struct {
-	id   string
-	data []byte
-	err  error
+	site    string
+	id      string
+	adapter SiteAdapter
+	link    string // product page
+	page    *page
+	last    *validator // validator used for the request
+	err     error
+}
+
+// page fetched
+type page struct {
+	data         []byte
+	etag         string
+	lastModified string
+	notModified  bool // 304 Not Modified
 }
 
-// ScrapingProducts fetches and parses multiple products from the site
+// Scraping fetches and parses multiple products from the site
 func (c *crawler) Scraping(productCodes ...string) []*Result {
+	return c.ScrapingContext(context.Background(), productCodes...)
+}
+
+// ScrapingContext fetches and parses multiple products from the site
+func (c *crawler) ScrapingContext(ctx context.Context, productCodes ...string) []*Result {
 	size := len(productCodes)
 
 	if size <= 0 {
 		return nil
 	}
 
-	respCh := make(chan *response, size)
-	resultCh := make(chan *Result, size)
-	go func(respCh <-chan *response, resultCh chan<- *Result) {
-		var wg sync.WaitGroup
-		for resp := range respCh {
-			wg.Add(1)
-			go func(resp response, resultCh chan<- *Result) {
-				defer wg.Done()
-				result := Result{
-					ProductCode: resp.id,
-				}
-				if resp.err == nil {
-					result.Product, result.Err = parseHTML(resp.data)
-
-				} else {
-					result.Err = resp.err
-				}
-
-				resultCh <- &result
-			}(*resp, resultCh)
+	results := make([]*Result, 0, size)
+	for result := range c.Stream(ctx, productCodes...) {
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// Stream fetches and parses multiple products from the site.
+// Pages are fetched by a pool of Settings.Concurrency workers
+// and parsed by at most Settings.MaxParsers goroutines.
+func (c *crawler) Stream(ctx context.Context, productCodes ...string) <-chan *Result {
+	jobCh := make(chan string)
+	respCh := make(chan *response, c.settings.Concurrency)
+	resultCh := make(chan *Result, c.settings.MaxParsers)
+
+	go c.parse(respCh, resultCh)
+
+	var wg sync.WaitGroup
+	for i := 0; i < c.settings.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for code := range jobCh {
+				respCh <- c.request(ctx, code)
+			}
+		}()
+	}
+
+	go func() {
+		for _, code := range productCodes {
+			select {
+			case jobCh <- code:
+			case <-ctx.Done():
+				// stop dispatching, report the rest as cancelled
+				site, id := SplitCode(code)
+				respCh <- &response{site: site, id: id, err: ctx.Err()}
+			}
 		}
+		close(jobCh)
 		wg.Wait()
-		close(resultCh)
-	}(respCh, resultCh)
+		close(respCh)
+	}()
 
-	for _, id := range productCodes {
-		resp := response{
-			id: id,
-		}
-		data, err := fetch(c.httpClient, baseURL+id)
-		if err != nil {
-			resp.err = err
-		} else {
-			resp.data = data
-		}
-		respCh <- &resp
+	return resultCh
+}
+
+// request fetches product page of the code provided
+func (c *crawler) request(ctx context.Context, code string) *response {
+	site, id := SplitCode(code)
+	resp := &response{
+		site: site,
+		id:   id,
 	}
-	close(respCh)
 
-	results := make([]*Result, size)
-	idx := 0
-	for result := range resultCh {
-		results[idx] = result
-		idx++
+	adapter, ok := GetSiteAdapter(site)
+	if !ok {
+		resp.err = ErrUnknownSite
+		return resp
 	}
+	resp.adapter = adapter
 
-	return results
-}
+	resp.last = c.validator(JoinCode(site, id))
 
-// fetch fetches web page from the site
-func fetch(httpClient HTTPClient, link string) ([]byte, error) {
-	// Set header
-	req, _ := http.NewRequest(http.MethodGet, link, nil)
-	req.Header.Set("user-agent", USER_AGENT)
+	resp.link = adapter.ProductURL(id)
+	resp.page, resp.err = c.get(ctx, resp.link, resp.last)
+	return resp
+}
 
-	// HTTP Request
-	res, err := httpClient.Do(req)
+// get fetches the link politely, transient errors will be retried
+// with exponential backoff up to Settings.MaxRetries times
+func (c *crawler) get(ctx context.Context, link string, last *validator) (*page, error) {
+	link = c.options.rebase(link)
+	u, err := url.Parse(link)
 	if err != nil {
-		return []byte{}, err
+		return nil, &FetchError{URL: link, Err: err}
 	}
-	defer res.Body.Close()
 
-	if res.StatusCode != 200 {
-		return []byte{}, fmt.Errorf("%d: %s", res.StatusCode, res.Status)
+	// the same user agent for robots.txt and all attempts
+	userAgent := c.userAgent()
+
+	for attempt := 0; ; attempt++ {
+		// host paused, i.e. under maintenance
+		if err := c.breaker.allow(u.Host, time.Now()); err != nil {
+			return nil, err
+		}
+
+		var p *page
+		if err = c.checkRobots(ctx, u, userAgent); err == nil {
+			if err = c.limiter.wait(ctx, u.Host); err != nil {
+				return nil, err
+			}
+			p, err = c.fetch(ctx, link, userAgent, last)
+			if ctx.Err() == nil {
+				c.breaker.report(u.Host, err, time.Now())
+			}
+		}
+		var blocked *BlockedError
+		if Classify(err) != Transient || attempt >= c.settings.MaxRetries || ctx.Err() != nil || errors.As(err, &blocked) {
+			return p, err
+		}
+
+		delay := backoff(attempt, c.settings.RetryBaseDelay, c.settings.RetryMaxDelay)
+		var fetchErr *FetchError
+		if errors.As(err, &fetchErr) && fetchErr.RetryAfter > delay {
+			// site asks to wait longer than we are willing to
+			if fetchErr.RetryAfter > c.settings.RetryMaxDelay {
+				return nil, err
+			}
+			delay = fetchErr.RetryAfter
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		}
 	}
+}
 
-	val, _ := io.ReadAll(res.Body)
-	if err != nil {
-		return []byte{}, err
+// parse parses responses with at most Settings.MaxParsers goroutines,
+// resultCh will be closed once all responses are parsed
+func (c *crawler) parse(respCh <-chan *response, resultCh chan<- *Result) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, c.settings.MaxParsers)
+	for resp := range respCh {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(resp *response) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			result := Result{
+				Site:        resp.site,
+				ProductCode: resp.id,
+			}
+			if resp.err == nil {
+				result.Product, result.Unchanged, result.Err = c.parsePage(resp)
+			} else {
+				result.Err = resp.err
+			}
+			result.Class = Classify(result.Err)
+
+			resultCh <- &result
+		}(resp)
 	}
-	return val, nil
+	wg.Wait()
+	close(resultCh)
 }
 
-var (
-	PRODUCT_NOT_FOUND = errors.New("Product Not Found")
-)
+// parsePage parses the page fetched and tells whether the product has changed
+func (c *crawler) parsePage(resp *response) (*Product, bool, error) {
+	if resp.page.notModified {
+		return resp.last.Product, true, nil
+	}
 
-// parseHTML converts html page to Product struct
-func parseHTML(html []byte) (*Product, error) {
+	if c.archive != nil {
+		if err := c.archive.Save(resp.site, resp.id, time.Now(), resp.page.data); err != nil {
+			log.Printf("failed to archive %s: %v", JoinCode(resp.site, resp.id), err)
+		}
+	}
 
-	page, err := goquery.NewDocumentFromReader(bytes.NewReader(html))
+	p, err := parseWith(resp.adapter, resp.page.data)
 	if err != nil {
-		return nil, err
+		return nil, false, c.blocked(resp, checkBlocked(resp.page.data, err))
 	}
 
-	title := ""
-	page.Find("h1[class='title']").Each(func(i int, s *goquery.Selection) {
-		title = s.Text()
-	})
+	knownStyles := 0
+	if resp.last != nil && resp.last.Product != nil {
+		knownStyles = len(resp.last.Product.Styles)
+		p, _ = RejectImplausible(p, resp.last.Product.acceptedPrice)
+	} else {
+		p, _ = RejectImplausible(p, nil)
+	}
+	if err := CheckDrift(p, 0); err != nil {
+		return nil, false, c.blocked(resp, checkBlocked(resp.page.data, err))
+	}
+	if err := c.drops.check(JoinCode(resp.site, resp.id), knownStyles, len(p.Styles)); err != nil {
+		return nil, false, c.blocked(resp, checkBlocked(resp.page.data, err))
+	}
 
-	// product has been removed
-	if title == "お探しの商品が見つかりません" {
-		return nil, PRODUCT_NOT_FOUND
+	v := &validator{
+		ETag:         resp.page.etag,
+		LastModified: resp.page.lastModified,
+		Hash:         hashProduct(p),
+		Product:      p,
 	}
+	c.validators.Add(JoinCode(resp.site, resp.id), v, cache.NEVER_EXPIRED)
+
+	unchanged := resp.last != nil && resp.last.Hash == v.Hash
+	return p, unchanged, nil
+}
 
-	newProduct := &Product{
-		Styles: []Style{},
+// ParsePage parses page of the product saved with the current parser of its site,
+// products failed drift checks are rejected, so are styles of implausible prices
+func ParsePage(site, productCode string, html []byte) *Result {
+	result := &Result{
+		Site:        site,
+		ProductCode: productCode,
 	}
 
-	// get product name
-	page.Find("h1[class='product-name text-weight-bold']").Each(func(i int, s *goquery.Selection) {
-		if i == 0 {
-			newProduct.Name = s.Text()
+	if adapter, ok := GetSiteAdapter(site); !ok {
+		result.Err = ErrUnknownSite
+	} else {
+		result.Product, result.Err = parseWith(adapter, html)
+		if result.Err == nil {
+			result.Product, _ = RejectImplausible(result.Product, nil)
+			if err := CheckDrift(result.Product, 0); err != nil {
+				result.Product, result.Err = nil, err
+			}
 		}
-	})
+		result.Err = checkBlocked(html, result.Err)
+	}
 
-	// find the target items
-	var colour, size, current, stock, sku string
-	page.Find("#commodityStandardAreaMessage").Parent().Each(func(i int, s *goquery.Selection) {
-		s.Find(".standard-info").Each(func(i int, s *goquery.Selection) {
+	result.Class = Classify(result.Err)
+	return result
+}
 
-			colour, _ = s.Attr("data-standard-detail2")
-			// check colour info
-			if colour == "-" {
-				colour = "Standard"
-			}
+// blocked completes *BlockedError of the page parsed and pauses its host,
+// other errors are returned as is
+func (c *crawler) blocked(resp *response, err error) error {
+	var blocked *BlockedError
+	if !errors.As(err, &blocked) {
+		return err
+	}
+	link := c.options.rebase(resp.link)
+	if blocked.URL == "" {
+		blocked.URL = link
+		blocked.StatusCode = http.StatusOK
+	}
+	if u, e := url.Parse(link); e == nil {
+		c.breaker.report(u.Host, blocked, time.Now())
+	}
+	return blocked
+}
 
-			size, _ = s.Attr("data-standard-detail1")
-			// check size info
-			if size == "-" {
-				size = "Standard"
-			}
+// checkBlocked replaces error of page cannot be parsed with *BlockedError
+// if the page looks like a captcha or anti-bot page
+func checkBlocked(html []byte, err error) error {
+	var blocked *BlockedError
+	if err == nil || err == PRODUCT_NOT_FOUND || errors.As(err, &blocked) {
+		return err
+	}
+	if b := detectBlocked(html); b != nil {
+		return b
+	}
+	return err
+}
 
-			// in case it has additional size info
-			if detail, exist := s.Attr("data-standard-detail12"); exist {
-				if detail != "-" {
-					size = size + "/" + detail
-				}
-			}
+// parseWith parses html with the adapter, errors other than
+// PRODUCT_NOT_FOUND and *BlockedError are wrapped by *ParseError
+func parseWith(adapter SiteAdapter, html []byte) (*Product, error) {
+	p, err := adapter.ParseHTML(html)
+	var blocked *BlockedError
+	if err != nil && err != PRODUCT_NOT_FOUND && !errors.As(err, &blocked) {
+		return nil, &ParseError{Err: err}
+	}
+	return p, err
+}
 
-			sku, _ = s.Attr("data-nucleus-sku-code")
+// userAgent returns user agents in turn
+func (c *crawler) userAgent() string {
+	n := atomic.AddUint64(&c.requests, 1) - 1
+	return c.settings.UserAgents[n%uint64(len(c.settings.UserAgents))]
+}
 
-			current, _ = s.Attr("data-price")
-			currentPrice, err := strconv.ParseUint(strings.ReplaceAll(current, ",", ""), 10, 64)
-			if err != nil {
-				currentPrice = 0
-			}
+// maxErrorPageSize is the size of error pages read to detect blocked pages
+const maxErrorPageSize = 1 << 20
 
-			stock, _ = s.Attr("data-stock-status")
-			stockNo := parseStock(stock)
-
-			image := ""
-			s.Siblings().Find(".variation-list_item").Each(func(i int, s *goquery.Selection) {
-				s.Find("input[name='color']").Each(func(i int, s *goquery.Selection) {
-					itemColor, _ := s.Attr("data-name")
-					if colour == itemColor {
-						image, _ = s.Attr("data-img")
-					}
-				})
-			})
-
-			if image == "" {
-				s.Siblings().Find(".variation-check-radio").Each(func(i int, s *goquery.Selection) {
-					s.Find("input[name='color']").Each(func(i int, s *goquery.Selection) {
-						itemColor, _ := s.Attr("data-name")
-						if colour == itemColor {
-							image, _ = s.Attr("data-img")
-						}
-					})
-				})
-			}
+// fetch fetches web page from the site within Settings.RequestTimeout,
+// conditional request will be sent if validator provided.
+// *FetchError will be returned if failed.
+func (c *crawler) fetch(ctx context.Context, link, userAgent string, last *validator) (*page, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.settings.RequestTimeout)
+	defer cancel()
 
-			if image == "" {
-				image = fmt.Sprintf("https://pic2.bellemaison.jp/shop/cms/images/0000/catalog/%s/%s_h1_001.jpg", sku[:7], sku[:7])
-			}
+	// Set header
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, &FetchError{URL: link, Err: err}
+	}
+	req.Header.Set("user-agent", userAgent)
+	last.setHeaders(req.Header)
 
-			newStyle := Style{
-				StyleCode: sku[7:],
-				ImageUrl:  image,
-				Colour:    colour,
-				Size:      size,
-				Price:     uint(currentPrice),
-				Stock:     stockNo,
-			}
-			newProduct.Styles = append(newProduct.Styles, newStyle)
-		})
-	})
+	// HTTP Request
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, &FetchError{URL: link, Err: err}
+	}
+	defer res.Body.Close()
 
-	return newProduct, nil
-}
+	if res.StatusCode == http.StatusNotModified && last != nil {
+		return &page{notModified: true}, nil
+	}
 
-func parseStock(description string) (stock uint) {
-	switch description {
-	case "在庫あり":
-		stock = 99
-	case "売り切れ":
-		fallthrough
-	case "販売停止":
-		fallthrough
-	case "売り切れ（再入荷なし）":
-		stock = 0
-	default:
-		if strings.Contains(description, "在庫：") {
-			temp := strings.Split(description, "：")
-			tempNo, err := strconv.ParseUint(temp[1], 10, 64)
-			if err != nil {
-				stock = 0
-			} else {
-				stock = uint(tempNo)
-			}
+	if res.StatusCode != 200 {
+		// i.e. captcha served with 403
+		body, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorPageSize))
+		var blocked *BlockedError
+		if errors.As(detectBlocked(body), &blocked) {
+			blocked.URL = link
+			blocked.StatusCode = res.StatusCode
+			blocked.RetryAfter = parseRetryAfter(res.Header.Get("Retry-After"))
+			return nil, blocked
 		}
-
-		if strings.Contains(description, "入荷予定") {
-			stock = 0
+		return nil, &FetchError{
+			URL:        link,
+			StatusCode: res.StatusCode,
+			RetryAfter: parseRetryAfter(res.Header.Get("Retry-After")),
 		}
 	}
-	return stock
+
+	val, err := io.ReadAll(io.LimitReader(res.Body, c.settings.MaxResponseSize+1))
+	if err != nil {
+		return nil, &FetchError{URL: link, Err: err}
+	}
+	if int64(len(val)) > c.settings.MaxResponseSize {
+		return nil, &FetchError{URL: link, Err: fmt.Errorf("%w: more than %d bytes", ErrResponseTooLarge, c.settings.MaxResponseSize)}
+	}
+	return &page{
+		data:         val,
+		etag:         res.Header.Get("ETag"),
+		lastModified: res.Header.Get("Last-Modified"),
+	}, nil
+}
+
+// Client returns http client fetches through the crawler
+func (c *crawler) Client() HTTPClient {
+	return &crawlerClient{c: c}
+}
+
+// crawlerClient implements HTTPClient, it sends GET requests with
+// crawler.get, the response is read fully before returned
+type crawlerClient struct {
+	c *crawler
+}
+
+func (cc *crawlerClient) Do(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return nil, fmt.Errorf("method %s not supported", req.Method)
+	}
+
+	p, err := cc.c.get(req.Context(), req.URL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          io.NopCloser(bytes.NewReader(p.data)),
+		ContentLength: int64(len(p.data)),
+		Request:       req,
+	}, nil
 }
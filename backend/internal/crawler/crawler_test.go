@@ -2,11 +2,25 @@ package crawler
 
 import (
 	"bytes"
+	"context"
+	"encoding/pem"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
 )
 
 type MockClient struct {
@@ -20,16 +34,26 @@ func (m *MockClient) Do(req *http.Request) (*http.Response, error) {
 	return &http.Response{}, nil
 }
 
+// withoutRobots returns 404 for robots.txt, other requests are handled by f
+func withoutRobots(f func(req *http.Request) (*http.Response, error)) func(req *http.Request) (*http.Response, error) {
+	return func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/robots.txt" {
+			return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader(""))}, nil
+		}
+		return f(req)
+	}
+}
+
 func TestNewCrawler(t *testing.T) {
 	c, err := NewCrawler()
 	if c == nil || err != nil {
 		t.Errorf("initializing crawler failed: %v", err)
 	}
-	c, err = NewCrawler(&http.Client{})
+	c, err = NewCrawler(WithHTTPClient(&http.Client{}))
 	if c == nil || err != nil {
 		t.Errorf("initializing crawler failed: %v", err)
 	}
-	c, err = NewCrawler(&http.Client{}, &http.Client{})
+	c, err = NewCrawler(WithHTTPClient(&http.Client{}), WithHTTPClient(&http.Client{}))
 	if c != nil || err != ErrMultipleClient {
 		t.Errorf("failed to prevent multiple http clients")
 	}
@@ -44,7 +68,7 @@ func TestRetrieveProduct_PageNotFound(t *testing.T) {
 			}, nil
 		},
 	}
-	c, err := NewCrawler(client)
+	c, err := NewCrawler(WithHTTPClient(client))
 	if c == nil || err != nil {
 		t.Errorf("initializing crawler failed: %v", err)
 	}
@@ -57,7 +81,7 @@ func TestRetrieveProduct_PageNotFound(t *testing.T) {
 
 func TestRetrieveProduct_ProductNotFound(t *testing.T) {
 	client := getMockClientwithFile("./test/failed.html")
-	c, err := NewCrawler(client)
+	c, err := NewCrawler(WithHTTPClient(client))
 	if c == nil || err != nil {
 		t.Errorf("initializing crawler failed: %v", err)
 	}
@@ -73,7 +97,7 @@ func TestRetrieveProduct_ProductNotFound(t *testing.T) {
 
 func TestRetrieveProduct_Success(t *testing.T) {
 	client := getMockClientwithFile("./test/success.html")
-	c, err := NewCrawler(client)
+	c, err := NewCrawler(WithHTTPClient(client))
 	if c == nil || err != nil {
 		t.Errorf("initializing crawler failed: %v", err)
 	}
@@ -88,6 +112,9 @@ func TestRetrieveProduct_Success(t *testing.T) {
 	if r.Product.Name != mockResult.Product.Name {
 		t.Errorf("Error: %v", err)
 	}
+	if r.Product.Extractor != EXTRACTOR_JSONLD {
+		t.Errorf("product not found by structured data: %s", r.Product.Extractor)
+	}
 	for i, mockStyle := range mockResult.Product.Styles {
 		if r.Product.Styles[i].StyleCode != mockStyle.StyleCode {
 			t.Errorf("style not match")
@@ -104,12 +131,1509 @@ func TestRetrieveProduct_Success(t *testing.T) {
 		if r.Product.Styles[i].Price != mockStyle.Price {
 			t.Errorf("price not match")
 		}
+		if r.Product.Styles[i].RegularPrice != mockStyle.RegularPrice ||
+			r.Product.Styles[i].SalePrice != mockStyle.SalePrice ||
+			r.Product.Styles[i].Discount != mockStyle.Discount {
+			t.Errorf("sale price not match")
+		}
+		if r.Product.Styles[i].Points != mockStyle.Points {
+			t.Errorf("points not match")
+		}
 		if r.Product.Styles[i].Stock != mockStyle.Stock {
 			t.Errorf("stock not match")
 		}
 	}
 }
 
+type mockSite struct{}
+
+func (m *mockSite) Name() string { return "mock" }
+func (m *mockSite) ProductURL(productCode string) string {
+	return "https://mock.example/" + productCode
+}
+func (m *mockSite) ValidateProductCode(code string) bool { return code != "" }
+func (m *mockSite) ParseHTML(html []byte) (*Product, error) {
+	return &Product{Name: string(html), Styles: []Style{{StyleCode: "001", Price: 1000}}}, nil
+}
+
+func TestScraping_SiteAdapter(t *testing.T) {
+	RegisterSiteAdapter(&mockSite{})
+
+	var requested string
+	client := &MockClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			requested = req.URL.String()
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewReader([]byte("mock product"))),
+			}, nil
+		},
+	}
+	c, err := NewCrawler(WithHTTPClient(client))
+	if c == nil || err != nil {
+		t.Errorf("initializing crawler failed: %v", err)
+	}
+
+	r := c.Scraping(JoinCode("mock", "abc"))[0]
+	if requested != "https://mock.example/abc" {
+		t.Errorf("request sent to wrong url: %s", requested)
+	}
+	if r.Err != nil || r.Site != "mock" || r.ProductCode != "abc" || r.Product.Name != "mock product" {
+		t.Errorf("result not parsed by site adapter: %+v", r)
+	}
+
+	r = c.Scraping(JoinCode("unknown", "abc"))[0]
+	if r.Err != ErrUnknownSite {
+		t.Errorf("unknown site not rejected")
+	}
+}
+
+func TestScraping_Concurrency(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	client := &MockClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+			return &http.Response{
+				StatusCode: http.StatusBadRequest,
+				Body:       io.NopCloser(bytes.NewReader([]byte{})),
+			}, nil
+		},
+	}
+	c, err := NewCrawler(WithSettings(&Settings{Concurrency: 3, RateLimit: -1}), WithHTTPClient(client))
+	if c == nil || err != nil {
+		t.Errorf("initializing crawler failed: %v", err)
+	}
+
+	codes := []string{"1000001", "1000002", "1000003", "1000004", "1000005", "1000006", "1000007"}
+	results := c.Scraping(codes...)
+	if len(results) != len(codes) {
+		t.Errorf("got %d results, wanted %d", len(results), len(codes))
+	}
+	if maxInFlight > 3 {
+		t.Errorf("%d requests in flight, wanted at most 3", maxInFlight)
+	}
+}
+
+func TestHostLimiter(t *testing.T) {
+	l := newHostLimiter(50, 1)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		l.wait(context.Background(), "www.bellemaison.jp")
+	}
+	// first request is served by the burst, the rest wait 20ms each
+	if elapsed := time.Since(start); elapsed < 75*time.Millisecond {
+		t.Errorf("requests not limited, took %v", elapsed)
+	}
+
+	start = time.Now()
+	l.wait(context.Background(), "another.host")
+	if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+		t.Errorf("hosts should be limited separately, took %v", elapsed)
+	}
+}
+
+func TestScraping_Retry(t *testing.T) {
+	file, err := os.ReadFile("./test/success.html")
+	if err != nil {
+		t.Fatal("test file not available")
+	}
+
+	attempts := 0
+	client := &MockClient{
+		DoFunc: withoutRobots(func(req *http.Request) (*http.Response, error) {
+			attempts++
+			switch attempts {
+			case 1:
+				return &http.Response{
+					StatusCode: http.StatusServiceUnavailable,
+					Body:       io.NopCloser(bytes.NewReader([]byte{})),
+				}, nil
+			case 2:
+				return &http.Response{
+					StatusCode: http.StatusTooManyRequests,
+					Header:     http.Header{"Retry-After": []string{"1"}},
+					Body:       io.NopCloser(bytes.NewReader([]byte{})),
+				}, nil
+			default:
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       io.NopCloser(bytes.NewReader(file)),
+				}, nil
+			}
+		}),
+	}
+	c, _ := NewCrawler(WithSettings(&Settings{
+		RateLimit:      -1,
+		MaxRetries:     3,
+		RetryBaseDelay: time.Millisecond,
+		RetryMaxDelay:  2 * time.Second,
+	}), WithHTTPClient(client))
+
+	start := time.Now()
+	r := c.Scraping(mockResult.ProductCode)[0]
+	if r.Err != nil || r.Class != NoError {
+		t.Errorf("transient errors not retried: %v", r.Err)
+	}
+	if attempts != 3 {
+		t.Errorf("got %d attempts, wanted 3", attempts)
+	}
+	if time.Since(start) < time.Second {
+		t.Errorf("Retry-After not respected")
+	}
+}
+
+func TestScraping_ErrorClass(t *testing.T) {
+	tests := []struct {
+		status  int
+		class   ErrorClass
+		retries int
+	}{
+		{http.StatusNotFound, Permanent, 0},
+		{http.StatusBadGateway, Transient, 2},
+	}
+
+	for _, test := range tests {
+		attempts := 0
+		client := &MockClient{
+			DoFunc: withoutRobots(func(req *http.Request) (*http.Response, error) {
+				attempts++
+				return &http.Response{
+					StatusCode: test.status,
+					Body:       io.NopCloser(bytes.NewReader([]byte{})),
+				}, nil
+			}),
+		}
+		c, _ := NewCrawler(WithSettings(&Settings{
+			RateLimit:      -1,
+			MaxRetries:     2,
+			RetryBaseDelay: time.Millisecond,
+		}), WithHTTPClient(client))
+
+		r := c.Scraping("1000000")[0]
+		var fetchErr *FetchError
+		if !errors.As(r.Err, &fetchErr) || fetchErr.StatusCode != test.status {
+			t.Errorf("%d: got error %v, wanted *FetchError", test.status, r.Err)
+		}
+		if r.Class != test.class {
+			t.Errorf("%d: got class %v, wanted %v", test.status, r.Class, test.class)
+		}
+		if attempts != test.retries+1 {
+			t.Errorf("%d: got %d attempts, wanted %d", test.status, attempts, test.retries+1)
+		}
+	}
+}
+
+func TestBlockedPages(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		html   string
+		reason error
+	}{
+		{"maintenance", http.StatusOK, `<html><head><title>ただいまメンテナンス中です</title></head><body></body></html>`, ErrMaintenance},
+		{"captcha", http.StatusForbidden, `<html><body><div class="g-recaptcha" data-sitekey="x"></div></body></html>`, ErrCaptcha},
+		{"challenge", http.StatusOK, `<html><head><title>Just a moment...</title></head><body></body></html>`, ErrCaptcha},
+		{"bot block", http.StatusForbidden, `<html><head><title>Access Denied</title></head><body></body></html>`, ErrBotBlocked},
+	}
+
+	for _, test := range tests {
+		client := &MockClient{
+			DoFunc: withoutRobots(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: test.status, Body: io.NopCloser(strings.NewReader(test.html))}, nil
+			}),
+		}
+		c, _ := NewCrawler(WithSettings(&Settings{RateLimit: -1, RetryBaseDelay: time.Millisecond}), WithHTTPClient(client))
+
+		r := c.Scraping("1000000")[0]
+		var blocked *BlockedError
+		if !errors.As(r.Err, &blocked) || !errors.Is(r.Err, test.reason) || blocked.StatusCode != test.status {
+			t.Errorf("%s: got error %v, wanted %v", test.name, r.Err, test.reason)
+		}
+		if r.Class != Transient || r.Product != nil {
+			t.Errorf("%s: got class %v and product %v", test.name, r.Class, r.Product)
+		}
+	}
+
+	// recaptcha on product page is not a captcha page
+	file, _ := os.ReadFile("./test/success.html")
+	html := bytes.Replace(file, []byte("</body>"), []byte(`<div class="g-recaptcha"></div></body>`), 1)
+	if r := ParsePage(BELLE_MAISON, "1129250", html); r.Err != nil {
+		t.Errorf("product page detected as blocked: %v", r.Err)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	b := newCircuitBreaker(2, time.Minute)
+	transient := &FetchError{StatusCode: http.StatusBadGateway}
+
+	b.report("a", transient, now)
+	if b.allow("a", now) != nil {
+		t.Error("opened before threshold")
+	}
+	b.report("a", nil, now)
+	b.report("a", transient, now)
+	if b.allow("a", now) != nil {
+		t.Error("failures not reset by success")
+	}
+	b.report("a", transient, now)
+	if err := b.allow("a", now); !errors.Is(err, ErrCircuitOpen) || Classify(err) != Transient {
+		t.Errorf("not opened after threshold: %v", err)
+	}
+	if b.allow("b", now) != nil {
+		t.Error("other host paused")
+	}
+
+	// half open after cooldown
+	now = now.Add(time.Minute)
+	if b.allow("a", now) != nil {
+		t.Error("not closed after cooldown")
+	}
+	b.report("a", transient, now)
+	if b.allow("a", now) == nil {
+		t.Error("not opened again after cooldown")
+	}
+
+	// blocked page opens at once, for Retry-After if longer
+	b.report("b", &BlockedError{Reason: ErrMaintenance, RetryAfter: time.Hour}, now)
+	if err := b.allow("b", now.Add(time.Minute)); err == nil {
+		t.Error("not opened by blocked page")
+	}
+	if newCircuitBreaker(-1, time.Minute).allow("a", now) != nil {
+		t.Error("disabled breaker paused host")
+	}
+}
+
+func TestScraping_CircuitBreaker(t *testing.T) {
+	requests := int32(0)
+	client := &MockClient{
+		DoFunc: withoutRobots(func(req *http.Request) (*http.Response, error) {
+			atomic.AddInt32(&requests, 1)
+			return &http.Response{
+				StatusCode: http.StatusForbidden,
+				Body:       io.NopCloser(strings.NewReader(`<html><body><div class="h-captcha"></div></body></html>`)),
+			}, nil
+		}),
+	}
+	c, _ := NewCrawler(WithSettings(&Settings{Concurrency: 1, RateLimit: -1}), WithHTTPClient(client))
+
+	results := c.Scraping("1000001", "1000002", "1000003")
+	if requests != 1 {
+		t.Errorf("got %d requests, wanted 1", requests)
+	}
+	for _, r := range results {
+		if r.Class != Transient || !errors.Is(r.Err, ErrCaptcha) && !errors.Is(r.Err, ErrCircuitOpen) {
+			t.Errorf("%s: unexpected error %v", r.ProductCode, r.Err)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	base, max := 100*time.Millisecond, time.Second
+	for n := 0; n < 10; n++ {
+		d := backoff(n, base, max)
+		if d < base/2 || d > max {
+			t.Errorf("attempt %d: delay %v out of range", n, d)
+		}
+	}
+}
+
+func TestScrapingContext_Cancel(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	client := &MockClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			requests++
+			mu.Unlock()
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		},
+	}
+	c, _ := NewCrawler(WithSettings(&Settings{Concurrency: 2, RateLimit: -1}), WithHTTPClient(client))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	codes := []string{"1000001", "1000002", "1000003", "1000004", "1000005"}
+	start := time.Now()
+	results := c.ScrapingContext(ctx, codes...)
+	if time.Since(start) > time.Second {
+		t.Errorf("crawling not cancelled")
+	}
+	if len(results) != len(codes) {
+		t.Errorf("got %d results, wanted %d", len(results), len(codes))
+	}
+	if requests > 2 {
+		t.Errorf("%d requests sent after cancelled", requests-2)
+	}
+	for _, r := range results {
+		if !errors.Is(r.Err, context.DeadlineExceeded) || r.Class != Transient {
+			t.Errorf("%s: got %v (%v), wanted transient context error", r.ProductCode, r.Err, r.Class)
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	release := make(chan struct{})
+	client := &MockClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			if strings.HasSuffix(req.URL.Path, "1000001") {
+				<-release // slow page
+			}
+			return &http.Response{
+				StatusCode: http.StatusNotFound,
+				Body:       io.NopCloser(bytes.NewReader([]byte{})),
+			}, nil
+		},
+	}
+	c, _ := NewCrawler(WithSettings(&Settings{Concurrency: 2, RateLimit: -1}), WithHTTPClient(client))
+
+	stream := c.Stream(context.Background(), "1000001", "1000002")
+	if r := <-stream; r.ProductCode != "1000002" {
+		t.Errorf("got %s first, wanted result of fast page", r.ProductCode)
+	}
+	close(release)
+	if r := <-stream; r.ProductCode != "1000001" {
+		t.Errorf("got %s, wanted 1000001", r.ProductCode)
+	}
+	if _, ok := <-stream; ok {
+		t.Errorf("stream not closed")
+	}
+}
+
+func TestScraping_Unchanged(t *testing.T) {
+	file, err := os.ReadFile("./test/success.html")
+	if err != nil {
+		t.Fatal("test file not available")
+	}
+
+	etag := ""
+	client := &MockClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			if etag != "" && req.Header.Get("If-None-Match") == etag {
+				return &http.Response{
+					StatusCode: http.StatusNotModified,
+					Body:       io.NopCloser(bytes.NewReader([]byte{})),
+				}, nil
+			}
+			header := http.Header{}
+			if etag != "" {
+				header.Set("ETag", etag)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     header,
+				Body:       io.NopCloser(bytes.NewReader(file)),
+			}, nil
+		},
+	}
+	c, _ := NewCrawler(WithSettings(&Settings{RateLimit: -1}), WithHTTPClient(client))
+
+	// content hash
+	if r := c.Scraping(mockResult.ProductCode)[0]; r.Err != nil || r.Unchanged {
+		t.Errorf("first request should not be unchanged: %v", r.Err)
+	}
+	if r := c.Scraping(mockResult.ProductCode)[0]; r.Err != nil || !r.Unchanged {
+		t.Errorf("same content should be unchanged: %v", r.Err)
+	}
+
+	// conditional request
+	etag = `"v1"`
+	c.Invalidate(mockResult.ProductCode)
+	if r := c.Scraping(mockResult.ProductCode)[0]; r.Err != nil || r.Unchanged {
+		t.Errorf("invalidated product should not be unchanged: %v", r.Err)
+	}
+	r := c.Scraping(mockResult.ProductCode)[0]
+	if r.Err != nil || !r.Unchanged {
+		t.Errorf("304 should be unchanged: %v", r.Err)
+	}
+	if r.Product == nil || r.Product.Name != mockResult.Product.Name {
+		t.Errorf("product of last request not returned for 304")
+	}
+}
+
+func TestArchive(t *testing.T) {
+	dir := t.TempDir()
+	client := getMockClientwithFile("./test/success.html")
+	c, _ := NewCrawler(WithSettings(&Settings{RateLimit: -1, ArchiveDir: dir}), WithHTTPClient(client))
+	c.Scraping(mockResult.ProductCode)
+
+	archive := NewArchive(dir)
+	snapshots, err := archive.Snapshots("", "")
+	if err != nil || len(snapshots) != 1 {
+		t.Fatalf("got %d snapshots, wanted 1: %v", len(snapshots), err)
+	}
+	if snapshots[0].Site != DEFAULT_SITE || snapshots[0].ProductCode != mockResult.ProductCode {
+		t.Errorf("snapshot stored with wrong key: %+v", snapshots[0])
+	}
+
+	r := snapshots[0].Parse()
+	if r.Err != nil || r.Product.Name != mockResult.Product.Name {
+		t.Errorf("failed to parse snapshot: %v", r.Err)
+	}
+
+	if snapshots, _ := archive.Snapshots(DEFAULT_SITE, "1000000"); len(snapshots) != 0 {
+		t.Errorf("got snapshots of another product")
+	}
+}
+
+func TestCassette(t *testing.T) {
+	file, err := os.ReadFile("./test/success.html")
+	if err != nil {
+		t.Fatal("test file not available")
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(file)
+	}))
+
+	dir := t.TempDir()
+	recorder, err := NewRecorder(dir, server.Client())
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/"+mockResult.ProductCode, nil)
+	res, err := recorder.Do(req)
+	if err != nil {
+		t.Fatalf("failed to record: %v", err)
+	}
+	if body, _ := io.ReadAll(res.Body); !bytes.Equal(body, file) {
+		t.Errorf("recorder changed response body")
+	}
+	server.Close()
+
+	// offline
+	replayer, err := NewReplayer(dir)
+	if err != nil {
+		t.Fatalf("failed to create replayer: %v", err)
+	}
+	res, err = replayer.Do(req)
+	if err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("failed to replay: %v", err)
+	}
+	if body, _ := io.ReadAll(res.Body); !bytes.Equal(body, file) {
+		t.Errorf("replayed body not match")
+	}
+
+	c, err := NewCrawler(WithSettings(&Settings{RateLimit: -1, CassetteMode: CASSETTE_REPLAY, CassetteDir: dir}))
+	if err != nil {
+		t.Fatalf("initializing crawler failed: %v", err)
+	}
+	r := c.Scraping("1000000")[0]
+	if !errors.Is(r.Err, ErrNotRecorded) || r.Class != Permanent {
+		t.Errorf("got %v (%v), wanted permanent ErrNotRecorded", r.Err, r.Class)
+	}
+}
+
+func TestCassette_Conditional(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("page"))
+	}))
+
+	dir := t.TempDir()
+	recorder, _ := NewRecorder(dir, server.Client())
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/page", nil)
+	conditional, _ := http.NewRequest(http.MethodGet, server.URL+"/page", nil)
+	conditional.Header.Set("If-None-Match", `"v1"`)
+	for _, r := range []*http.Request{req, conditional} {
+		if _, err := recorder.Do(r); err != nil {
+			t.Fatalf("failed to record: %v", err)
+		}
+	}
+	server.Close()
+
+	replayer, _ := NewReplayer(dir)
+	res, err := replayer.Do(req)
+	if err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("page recorded replaced: %v %v", res, err)
+	}
+	if body, _ := io.ReadAll(res.Body); string(body) != "page" {
+		t.Errorf("replayed body not match: %q", body)
+	}
+	if res, err := replayer.Do(conditional); err != nil || res.StatusCode != http.StatusNotModified {
+		t.Errorf("got %v %v, wanted 304", res, err)
+	}
+
+	// validators not recorded, the page is served
+	conditional.Header.Set("If-None-Match", `"v0"`)
+	if res, err := replayer.Do(conditional); err != nil || res.StatusCode != http.StatusOK {
+		t.Errorf("got %v %v, wanted 200", res, err)
+	}
+}
+
+func TestParseHTML_Sale(t *testing.T) {
+	html := `<html><body><h1 class="product-name text-weight-bold">Sale Item</h1>
+<div class="section">
+ <div id="commodityStandardAreaMessage"></div>
+ <div class="standard-info" data-stock-status="在庫あり" data-price="7,000" data-list-price="10,000"
+      data-nucleus-sku-code="112925001001" data-standard-detail1="M" data-standard-detail2="Red"
+      data-sale="true"></div>
+</div></body></html>`
+
+	// list price is read only if configured
+	p, err := parseHTML([]byte(html), DefaultSelectors())
+	if err != nil || len(p.Styles) != 1 {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if p.Extractor != EXTRACTOR_DOM {
+		t.Errorf("unexpected extractor: %s", p.Extractor)
+	}
+	if style := p.Styles[0]; style.Price != 7000 || style.RegularPrice != 7000 || style.SalePrice != 7000 || style.Discount != 0 {
+		t.Errorf("sale not parsed: %+v", style)
+	}
+
+	sel := DefaultSelectors()
+	sel.Attributes.ListPrice = "data-list-price"
+	p, err = parseHTML([]byte(html), sel)
+	if err != nil || len(p.Styles) != 1 {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if style := p.Styles[0]; style.Price != 7000 || style.RegularPrice != 10000 || style.SalePrice != 7000 || style.Discount != 30 {
+		t.Errorf("list price not parsed: %+v", style)
+	}
+}
+
+func TestParseHTML_NotOnSale(t *testing.T) {
+	// data-sale="false" data-outlet="false" on the page saved
+	file, err := os.ReadFile("./test/success.html")
+	if err != nil {
+		t.Fatal("test file not available")
+	}
+	p, err := parseHTML(file, DefaultSelectors())
+	if err != nil || len(p.Styles) != 1 {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if style := p.Styles[0]; style.Price != 6578 || style.RegularPrice != 6578 || style.SalePrice != 0 || style.Discount != 0 {
+		t.Errorf("regular price not parsed: %+v", style)
+	}
+}
+
+func TestSelectors(t *testing.T) {
+	invalid := DefaultSelectors()
+	invalid.Style = "div[class="
+	if err := invalid.Validate(); err == nil {
+		t.Errorf("invalid selector accepted")
+	}
+
+	if err := (&SelectorFile{Version: SELECTOR_VERSION + 1}).Validate(); err == nil {
+		t.Errorf("unsupported version accepted")
+	}
+
+	file := &SelectorFile{Version: SELECTOR_VERSION, Sites: map[string]*Selectors{"unknown": DefaultSelectors()}}
+	if err := ApplySelectors(file); !errors.Is(err, ErrUnknownSite) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// site redesigned
+	adapter, _ := GetSiteAdapter(BELLE_MAISON)
+	configurable := adapter.(SelectorConfigurable)
+	defer configurable.SetSelectors(DefaultSelectors())
+
+	redesigned := DefaultSelectors()
+	redesigned.ProductName = "h1.name"
+	redesigned.Style = ".sku"
+	redesigned.Attributes.Price = "data-amount"
+	file = &SelectorFile{Version: SELECTOR_VERSION, Sites: map[string]*Selectors{BELLE_MAISON: redesigned}}
+	if err := ApplySelectors(file); err != nil {
+		t.Fatalf("failed to apply selectors: %v", err)
+	}
+
+	html := `<html><body><h1 class="name">New Layout</h1>
+<div class="section">
+ <div id="commodityStandardAreaMessage"></div>
+ <div class="sku" data-stock-status="在庫あり" data-amount="5,000"
+      data-nucleus-sku-code="112925001001" data-standard-detail1="M" data-standard-detail2="Red"></div>
+</div></body></html>`
+
+	p, err := adapter.ParseHTML([]byte(html))
+	if err != nil || len(p.Styles) != 1 {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if p.Name != "New Layout" || p.Styles[0].Price != 5000 {
+		t.Errorf("selectors not applied: %+v", p)
+	}
+}
+
+func TestCheckDrift(t *testing.T) {
+	styles := []Style{{StyleCode: "001", Price: 1000}, {StyleCode: "002", Price: 1000}}
+
+	cases := []struct {
+		product     *Product
+		knownStyles int
+		drift       bool
+	}{
+		{&Product{Name: "item", Styles: styles}, 0, false},
+		{&Product{Name: "item", Styles: styles}, 3, false},
+		{&Product{Name: "item", Styles: styles}, 5, true},
+		{&Product{Name: "item", Styles: []Style{}}, 0, true},
+		{&Product{Styles: styles}, 0, true},
+		{&Product{Name: "item", Styles: []Style{{StyleCode: "001"}}}, 0, true},
+		{&Product{Name: "item", Styles: []Style{{StyleCode: "001"}, {StyleCode: "002", Price: 1000}}}, 0, false},
+	}
+	for i, c := range cases {
+		err := CheckDrift(c.product, c.knownStyles)
+		if (err != nil) != c.drift {
+			t.Errorf("case %d: unexpected result: %v", i, err)
+		}
+		if err != nil && (!errors.Is(err, ErrParseDrift) || Classify(err) != Permanent) {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		}
+	}
+}
+
+func TestRejectImplausible(t *testing.T) {
+	last := &Product{Styles: []Style{{StyleCode: "001", Price: 1000}, {StyleCode: "002", Price: 1000}, {StyleCode: "003", Price: 1000, Rejected: REJECT_PRICE_JUMP}}}
+	original := &Product{Styles: []Style{
+		{StyleCode: "001", Price: 1200, RawPrice: "1,200"},
+		{StyleCode: "002", Price: 12000, RawPrice: "12,000"},
+		{StyleCode: "003", Price: 12000, RawPrice: "12,000"}, // last price rejected
+		{StyleCode: "004", RawPrice: "-500"},
+		{StyleCode: "005", RawPrice: "価格未定"},
+		{StyleCode: "006", RawPrice: "0"},
+		{StyleCode: "007", Price: 50, RawPrice: "50"}, // new style
+	}}
+
+	p, n := RejectImplausible(original, last.acceptedPrice)
+	if n != 4 {
+		t.Errorf("unexpected number of styles rejected: %d", n)
+	}
+	if original.Styles[1].Rejected != "" {
+		t.Errorf("product checked is modified")
+	}
+	expected := []string{"", REJECT_PRICE_JUMP, "", REJECT_NEGATIVE_PRICE, REJECT_INVALID_PRICE, REJECT_ZERO_PRICE, ""}
+	for i, style := range p.Styles {
+		if style.Rejected != expected[i] {
+			t.Errorf("style %s: expected %q, got %q", style.StyleCode, expected[i], style.Rejected)
+		}
+	}
+	if accepted := p.Accepted(); len(accepted) != 3 || accepted[2].StyleCode != "007" {
+		t.Errorf("unexpected styles accepted: %+v", accepted)
+	}
+
+	// price drop
+	if reason := CheckObservation(&Style{Price: 99}, 1000); reason != REJECT_PRICE_JUMP {
+		t.Errorf("price drop not rejected: %q", reason)
+	}
+}
+
+func TestParseHTML_InvalidPrice(t *testing.T) {
+	html := `<html><body><h1 class="product-name text-weight-bold">Item</h1>
+<div class="section">
+ <div id="commodityStandardAreaMessage"></div>
+ <div class="standard-info" data-stock-status="在庫：3" data-price="-"
+      data-nucleus-sku-code="112925001001" data-standard-detail1="M" data-standard-detail2="Red"></div>
+ <div class="standard-info" data-stock-status="在庫：3" data-price="7,000"
+      data-nucleus-sku-code="112925001002" data-standard-detail1="L" data-standard-detail2="Red"></div>
+ <div class="standard-info" data-stock-status="在庫：3" data-price="7,000"
+      data-nucleus-sku-code="11292" data-standard-detail1="S" data-standard-detail2="Red"></div>
+</div></body></html>`
+
+	// style of short sku skipped, no panic
+	r := ParsePage(DEFAULT_SITE, "1129250", []byte(html))
+	if r.Err != nil || len(r.Product.Styles) != 2 {
+		t.Fatalf("failed to parse: %+v", r)
+	}
+	if s := r.Product.Styles[0]; s.Rejected != REJECT_INVALID_PRICE || s.RawPrice != "-" || s.Price != 0 {
+		t.Errorf("invalid price not rejected: %+v", s)
+	}
+	if s := r.Product.Styles[1]; s.Rejected != "" || s.Price != 7000 {
+		t.Errorf("valid price rejected: %+v", s)
+	}
+}
+
+func TestScraping_ParseDrift(t *testing.T) {
+	// markup changed, no style can be found
+	client := &MockClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewReader([]byte(`<html><body><h1 class="product-name text-weight-bold">Item</h1></body></html>`))),
+			}, nil
+		},
+	}
+	c, _ := NewCrawler(WithHTTPClient(client))
+
+	r := c.Scraping("1129250")[0]
+	if !errors.Is(r.Err, ErrParseDrift) || r.Product != nil {
+		t.Errorf("parser drift not detected: %+v", r)
+	}
+}
+
+func TestScraping_StyleDrop(t *testing.T) {
+	style := `<div class="standard-info" data-stock-status="在庫：3" data-price="7,000"
+      data-nucleus-sku-code="11292500100%d" data-standard-detail1="M" data-standard-detail2="Colour%d"></div>`
+	page := func(styles int) []byte {
+		html := `<html><body><h1 class="product-name text-weight-bold">Item</h1><div class="section"><div id="commodityStandardAreaMessage"></div>`
+		for i := 1; i <= styles; i++ {
+			html += fmt.Sprintf(style, i, i)
+		}
+		return []byte(html + `</div></body></html>`)
+	}
+
+	styles := 3
+	client := &MockClient{
+		DoFunc: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(page(styles)))}, nil
+		},
+	}
+	c, _ := NewCrawler(WithSettings(&Settings{RateLimit: -1, IgnoreRobots: true}), WithHTTPClient(client))
+	if r := c.Scraping("1129250")[0]; r.Err != nil {
+		t.Fatalf("failed to scrape: %v", r.Err)
+	}
+
+	// rejected until observed in a row, then accepted as product change
+	styles = 1
+	for i := 1; i < StyleDropConfirmations; i++ {
+		if r := c.Scraping("1129250")[0]; !errors.Is(r.Err, ErrParseDrift) {
+			t.Errorf("observation %d: style drop not rejected: %v", i, r.Err)
+		}
+	}
+	if r := c.Scraping("1129250")[0]; r.Err != nil || len(r.Product.Styles) != 1 {
+		t.Fatalf("style drop not accepted: %v", r.Err)
+	}
+	if r := c.Scraping("1129250")[0]; r.Err != nil || !r.Unchanged {
+		t.Errorf("product dropped styles not remembered: %v, unchanged: %v", r.Err, r.Unchanged)
+	}
+
+	// count restarts once styles are back
+	styles = 3
+	if r := c.Scraping("1129250")[0]; r.Err != nil {
+		t.Fatalf("failed to scrape: %v", r.Err)
+	}
+	styles = 1
+	if r := c.Scraping("1129250")[0]; !errors.Is(r.Err, ErrParseDrift) {
+		t.Errorf("style drop not rejected: %v", r.Err)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	ld := `<script type="application/ld+json">[{"@type": "Product", "sku": "112925001001", "name": "Item",
+ "Offers": {"@type": "Offer", "Price": "%s", "availability": "http://schema.org/InStock"}}]</script>`
+	dom := `<h1 class="product-name text-weight-bold">Item</h1>
+<div class="section">
+ <div id="commodityStandardAreaMessage"></div>
+ <div class="standard-info" data-stock-status="在庫：3" data-price="7,000"
+      data-nucleus-sku-code="112925001001" data-standard-detail1="M" data-standard-detail2="Red"></div>
+</div>`
+
+	// completed by dom
+	p, err := parseHTML([]byte(fmt.Sprintf("<html><body>"+ld+dom+"</body></html>", "7000")), DefaultSelectors())
+	if err != nil || len(p.Styles) != 1 {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	style := p.Styles[0]
+	if p.Extractor != EXTRACTOR_JSONLD || style.Colour != "Red" || style.Size != "M" || style.Stock.Quantity != 3 {
+		t.Errorf("product not merged: %+v", p)
+	}
+
+	// markup changed, found by structured data only
+	p, err = parseHTML([]byte(fmt.Sprintf("<html><body>"+ld+"</body></html>", "7000")), DefaultSelectors())
+	if err != nil || p.Extractor != EXTRACTOR_JSONLD || p.Styles[0].Price != 7000 || p.Styles[0].Stock.State != InStock {
+		t.Errorf("product not found by structured data: %+v, %v", p, err)
+	}
+
+	// extractors disagree
+	_, err = parseHTML([]byte(fmt.Sprintf("<html><body>"+ld+dom+"</body></html>", "6000")), DefaultSelectors())
+	if !errors.Is(err, ErrParseDrift) {
+		t.Errorf("disagreement not detected: %v", err)
+	}
+}
+
+func TestStyleByName(t *testing.T) {
+	ld := `<html><body><script type="application/ld+json">[
+ {"@type": "Product", "sku": "112925001001", "name": "Item", %s "Offers": {"@type": "Offer", "Price": "7000"}}
+]</script></body></html>`
+
+	// colour and size not provided, the only style
+	p, err := parseHTML([]byte(fmt.Sprintf(ld, "")), DefaultSelectors())
+	if err != nil || p.Extractor != EXTRACTOR_JSONLD {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if s := p.StyleByName("", ""); s == nil || s.StyleCode != "01001" {
+		t.Errorf("the only style not found: %+v", s)
+	}
+	if s := p.StyleByName("Red", "M"); s != nil {
+		t.Errorf("unexpected style: %+v", s)
+	}
+
+	// by color and size of structured data
+	p, err = parseHTML([]byte(fmt.Sprintf(ld, `"color": "Red", "size": "M",`)), DefaultSelectors())
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if s := p.StyleByName("Red", "M"); s == nil || s.StyleCode != "01001" {
+		t.Errorf("style not found by colour and size: %+v", p.Styles)
+	}
+}
+
+func TestProductDetails(t *testing.T) {
+	file, _ := os.ReadFile("./test/success.html")
+	expectedBreadcrumb := []Category{{"10", "コスメ/美容/健康"}, {"1009", "健康家電/健康用品"}, {"100901", "マッサージ機/ボディケア家電"}}
+
+	// by structured data and by dom
+	for _, sel := range []*Selectors{DefaultSelectors(), func() *Selectors { s := DefaultSelectors(); s.StructuredData = ""; return s }()} {
+		p, err := parseHTML(file, sel)
+		if err != nil {
+			t.Fatalf("failed to parse: %v", err)
+		}
+		if !reflect.DeepEqual(p.Breadcrumb, expectedBreadcrumb) {
+			t.Errorf("%s: unexpected breadcrumb: %+v", p.Extractor, p.Breadcrumb)
+		}
+		if !strings.HasPrefix(p.Description, "●約47×5×90cm\n●本体重量／約1.3kg\n") {
+			t.Errorf("%s: unexpected description: %q", p.Extractor, p.Description)
+		}
+		if len(p.Specs) != 10 || p.Specs[0] != (Spec{Value: "約47×5×90cm"}) || p.Specs[1] != (Spec{"本体重量", "約1.3kg"}) {
+			t.Errorf("%s: unexpected specs: %+v", p.Extractor, p.Specs)
+		}
+	}
+
+	page := `<html><body><table class="spec"><tr><th>素材</th><td>綿100%<br>日本製</td></tr><tr><th>-</th><td></td></tr></table></body></html>`
+	doc, _ := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if specs := parseSpecTable(doc, "table.spec"); !reflect.DeepEqual(specs, []Spec{{"素材", "綿100%\n日本製"}}) {
+		t.Errorf("unexpected spec table: %+v", specs)
+	}
+}
+
+func TestProxyPool(t *testing.T) {
+	now := time.Now()
+
+	pool, err := newProxyPool([]string{"http://a:8080", "socks5://b:1080"}, PROXY_ROUND_ROBIN, 2, time.Minute)
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+	a, _ := pool.pick(now)
+	b, _ := pool.pick(now)
+	if a.url.Host != "a:8080" || b.url.Host != "b:1080" {
+		t.Errorf("proxies not picked in turn: %s, %s", a.url, b.url)
+	}
+
+	// evicted after failed in a row
+	pool.report(a, true, now)
+	pool.report(a, true, now)
+	for i := 0; i < 3; i++ {
+		if px, _ := pool.pick(now); px != b {
+			t.Errorf("evicted proxy picked: %s", px.url)
+		}
+	}
+	pool.report(b, true, now)
+	pool.report(b, true, now)
+	if _, err := pool.pick(now); err != ErrNoProxy {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if px, _ := pool.pick(now.Add(time.Minute)); px == nil {
+		t.Errorf("proxy not put back after cooldown")
+	}
+
+	pool, _ = newProxyPool([]string{"http://a:8080", "http://b:8080"}, PROXY_LEAST_ERRORS, 3, time.Minute)
+	a, _ = pool.pick(now)
+	pool.report(a, true, now)
+	for i := 0; i < 3; i++ {
+		if px, _ := pool.pick(now); px == a {
+			t.Errorf("proxy of higher error rate picked")
+		}
+	}
+
+	if _, err := newProxyPool([]string{"ftp://a"}, PROXY_ROUND_ROBIN, 3, time.Minute); err == nil {
+		t.Errorf("unsupported proxy accepted")
+	}
+	if _, err := newProxyPool([]string{"http://a"}, "random", 3, time.Minute); err == nil {
+		t.Errorf("unknown strategy accepted")
+	}
+}
+
+// httpSite is mockSite served by plain http
+type httpSite struct{ mockSite }
+
+func (m *httpSite) Name() string { return "http" }
+func (m *httpSite) ProductURL(productCode string) string {
+	return "http://mock.example/" + productCode
+}
+
+func TestScraping_Proxy(t *testing.T) {
+	RegisterSiteAdapter(&httpSite{})
+
+	// http proxy receives requests in absolute form
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.String()
+		w.Write([]byte("mock product"))
+	}))
+	defer server.Close()
+
+	c, err := NewCrawler(WithSettings(&Settings{Proxies: []string{server.URL}, RateLimit: -1}))
+	if err != nil {
+		t.Fatalf("initializing crawler failed: %v", err)
+	}
+	r := c.Scraping(JoinCode("http", "abc"))[0]
+	if r.Err != nil || requested != "http://mock.example/abc" {
+		t.Errorf("request not sent through proxy: %s, %v", requested, r.Err)
+	}
+}
+
+func TestScraping_Socks5h(t *testing.T) {
+	RegisterSiteAdapter(&httpSite{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("mock product"))
+	}))
+	defer server.Close()
+
+	// socks5 proxy without authentication, connects to server whatever requested
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+	hosts := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				buf := make([]byte, 262)
+				// greeting: version, number of methods, methods
+				if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+					return
+				}
+				io.ReadFull(conn, buf[:buf[1]])
+				conn.Write([]byte{5, 0})
+
+				// request: version, connect, reserved, address type, address, port
+				if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+					return
+				}
+				switch buf[3] {
+				case 3: // domain name
+					io.ReadFull(conn, buf[:1])
+					io.ReadFull(conn, buf[1:1+buf[0]])
+					hosts <- string(buf[1 : 1+buf[0]])
+				case 1: // ipv4
+					io.ReadFull(conn, buf[:4])
+					hosts <- net.IP(buf[:4]).String()
+				default:
+					return
+				}
+				io.ReadFull(conn, buf[:2])
+
+				backend, err := net.Dial("tcp", server.Listener.Addr().String())
+				if err != nil {
+					return
+				}
+				defer backend.Close()
+				conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+				go io.Copy(backend, conn)
+				io.Copy(conn, backend)
+			}(conn)
+		}
+	}()
+
+	c, err := NewCrawler(WithSettings(&Settings{Proxies: []string{"socks5h://" + ln.Addr().String()}, RateLimit: -1, IgnoreRobots: true}))
+	if err != nil {
+		t.Fatalf("initializing crawler failed: %v", err)
+	}
+	r := c.Scraping(JoinCode("http", "abc"))[0]
+	if r.Err != nil {
+		t.Fatalf("request not sent through proxy: %v", r.Err)
+	}
+	// host name resolved by the proxy
+	if host := <-hosts; host != "mock.example" {
+		t.Errorf("host name resolved locally: %s", host)
+	}
+}
+
+func TestUserAgentRotation(t *testing.T) {
+	agents := []string{}
+	client := &MockClient{
+		DoFunc: withoutRobots(func(req *http.Request) (*http.Response, error) {
+			agents = append(agents, req.Header.Get("user-agent"))
+			return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader(""))}, nil
+		}),
+	}
+	c, _ := NewCrawler(WithSettings(&Settings{UserAgents: []string{"a", "b"}, Concurrency: 1, RateLimit: -1}), WithHTTPClient(client))
+	c.Scraping("1000001", "1000002", "1000003")
+	if strings.Join(agents, ",") != "a,b,a" {
+		t.Errorf("user agents not rotated: %v", agents)
+	}
+}
+
+func TestParseRobots(t *testing.T) {
+	r := parseRobots([]byte(`# comment
+User-agent: examplebot
+Disallow: /
+
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Disallow: /*.json$
+Disallow:
+Crawl-delay: 1.5
+`))
+
+	tests := []struct {
+		userAgent string
+		path      string
+		allowed   bool
+	}{
+		{USER_AGENT, "/shop/commodity/0000/1129250", true},
+		{USER_AGENT, "/private/item", false},
+		{USER_AGENT, "/private/public/item", true},
+		{USER_AGENT, "/data/item.json", false},
+		{USER_AGENT, "/data/item.json?page=1", true},
+		{"Mozilla/5.0 (compatible; ExampleBot/1.0)", "/shop", false},
+	}
+	for _, test := range tests {
+		if r.allowed(test.userAgent, test.path) != test.allowed {
+			t.Errorf("%s: wanted allowed = %v", test.path, test.allowed)
+		}
+	}
+	if r.crawlDelay(USER_AGENT) != 1500*time.Millisecond {
+		t.Errorf("unexpected crawl delay: %v", r.crawlDelay(USER_AGENT))
+	}
+}
+
+// serverSite is mockSite served by test server
+type serverSite struct {
+	mockSite
+	url string
+}
+
+func (m *serverSite) Name() string { return "server" }
+func (m *serverSite) ProductURL(productCode string) string {
+	return m.url + "/" + productCode
+}
+
+func TestScraping_Robots(t *testing.T) {
+	var mu sync.Mutex
+	requested := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.Path]++
+		mu.Unlock()
+
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nDisallow: /private\nCrawl-delay: 0.2\n"))
+			return
+		}
+		w.Write([]byte("mock product"))
+	}))
+	defer server.Close()
+	RegisterSiteAdapter(&serverSite{url: server.URL})
+
+	c, _ := NewCrawler(WithSettings(&Settings{RateLimit: -1}))
+
+	r := c.Scraping(JoinCode("server", "private"))[0]
+	if !errors.Is(r.Err, ErrDisallowed) || r.Class != Permanent {
+		t.Errorf("disallowed path not refused: %v", r.Err)
+	}
+	if requested["/private"] != 0 {
+		t.Errorf("disallowed path requested")
+	}
+
+	// crawl delay applied
+	start := time.Now()
+	for _, result := range c.Scraping(JoinCode("server", "a"), JoinCode("server", "b"), JoinCode("server", "c")) {
+		if result.Err != nil {
+			t.Errorf("allowed path refused: %v", result.Err)
+		}
+	}
+	if time.Since(start) < 400*time.Millisecond {
+		t.Errorf("crawl delay not respected")
+	}
+	if requested["/robots.txt"] != 1 {
+		t.Errorf("robots.txt fetched %d times, wanted 1", requested["/robots.txt"])
+	}
+
+	c, _ = NewCrawler(WithSettings(&Settings{RateLimit: -1, IgnoreRobots: true}))
+	if r := c.Scraping(JoinCode("server", "private"))[0]; r.Err != nil || requested["/private"] != 1 {
+		t.Errorf("robots.txt not ignored: %v", r.Err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+		case "/image.jpg":
+			w.Write([]byte(r.UserAgent()))
+		case "/large.jpg":
+			requests++
+			w.Write(bytes.Repeat([]byte("x"), 100))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c, _ := NewCrawler(WithSettings(&Settings{RateLimit: -1, MaxResponseSize: 10}), WithUserAgent("test"))
+	client := c.Client()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/image.jpg", nil)
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("failed to fetch: %v", err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || string(body) != "test" {
+		t.Errorf("got %d %q, wanted 200 with user agent of crawler", res.StatusCode, body)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/private/image.jpg", nil)
+	if _, err := client.Do(req); !errors.Is(err, ErrDisallowed) {
+		t.Errorf("disallowed path not refused: %v", err)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/large.jpg", nil)
+	if _, err := client.Do(req); !errors.Is(err, ErrResponseTooLarge) || Classify(err) != Permanent || requests != 1 {
+		t.Errorf("got %v after %d requests, wanted ErrResponseTooLarge without retry", err, requests)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/missing.jpg", nil)
+	var fetchErr *FetchError
+	if _, err := client.Do(req); !errors.As(err, &fetchErr) || fetchErr.StatusCode != http.StatusNotFound {
+		t.Errorf("got %v, wanted *FetchError of 404", err)
+	}
+}
+
+func TestListing(t *testing.T) {
+	file, err := os.ReadFile("./test/listing.html")
+	if err != nil {
+		t.Fatal("test file not available")
+	}
+
+	var requested string
+	client := &MockClient{
+		DoFunc: withoutRobots(func(req *http.Request) (*http.Response, error) {
+			requested = req.URL.String()
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(file))}, nil
+		}),
+	}
+	c, _ := NewCrawler(WithSettings(&Settings{RateLimit: -1}), WithHTTPClient(client))
+
+	listing, err := c.Search(context.Background(), BELLE_MAISON, "タオル", 1)
+	if err != nil {
+		t.Fatalf("failed to search: %v", err)
+	}
+	if requested != listingURL+"?keyword=%E3%82%BF%E3%82%AA%E3%83%AB&page=1" {
+		t.Errorf("unexpected url: %s", requested)
+	}
+	if len(listing.Products) != 2 || !listing.HasNext || listing.Page != 1 {
+		t.Fatalf("listing not parsed: %+v", listing)
+	}
+	item := listing.Products[1]
+	if item.ProductCode != "1234567" || item.Name != "ふんわりタオル" || item.Price != 1990 ||
+		item.ImageUrl != "https://pic2.bellemaison.jp/shop/cms/images/0000/catalog/1234567/1234567_h1_001.jpg" {
+		t.Errorf("item not parsed: %+v", item)
+	}
+	if listing.Products[0].ImageUrl != "https://pic2.bellemaison.jp/shop/cms/images/0000/catalog/1129250/1129250_h1_001.jpg" {
+		t.Errorf("lazy loaded image not parsed: %s", listing.Products[0].ImageUrl)
+	}
+
+	if _, err := c.Category(context.Background(), BELLE_MAISON, "1009", 2); err != nil ||
+		requested != listingURL+"?categoryList=1009&page=2" {
+		t.Errorf("unexpected category url: %s, %v", requested, err)
+	}
+
+	RegisterSiteAdapter(&mockSite{})
+	if _, err := c.Search(context.Background(), "mock", "item", 1); !errors.Is(err, ErrListingNotSupported) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// pager links to the next page the same way
+	page, _ := goquery.NewDocumentFromReader(bytes.NewReader(file))
+	next, _ := url.Parse(page.Find(DefaultSelectors().Listing.NextPage).AttrOr("href", ""))
+	if next.Query().Get("keyword") != "タオル" || next.Query().Get("page") != "2" {
+		t.Errorf("fixture links to next page differently: %s", next)
+	}
+
+	// selectors not matched
+	file = []byte(`<html><body><div class="result-list"><div class="result">item</div></div></body></html>`)
+	if _, err := c.Search(context.Background(), BELLE_MAISON, "タオル", 1); !errors.Is(err, ErrParseDrift) || Classify(err) != Permanent {
+		t.Errorf("empty listing not rejected: %v", err)
+	}
+}
+
+func TestListing_URL(t *testing.T) {
+	// search box and category links of pages captured from the site
+	file, _ := os.ReadFile("./test/success.html")
+	page, _ := goquery.NewDocumentFromReader(bytes.NewReader(file))
+	if page.Find(`form[name="form_head"] input[name="keyword"]`).Length() != 1 {
+		t.Errorf("search box not found")
+	}
+	b := &bellemaison{}
+	for _, link := range []string{b.SearchURL("タオル", 1), b.CategoryURL("1009", 1)} {
+		u, _ := url.Parse(link)
+		if !strings.HasPrefix(link, "https://www.bellemaison.jp/shop/app/catalog/list/?") ||
+			u.Query().Get("keyword") == "" && u.Query().Get("categoryList") == "" {
+			t.Errorf("unexpected url: %s", link)
+		}
+	}
+	if page.Find(`a[href="/shop/app/catalog/list/?categoryList=1009"]`).Length() == 0 {
+		t.Errorf("category link not found")
+	}
+}
+
+func TestListing_Blocked(t *testing.T) {
+	pages := map[string]error{
+		`<html><head><title>ただいまメンテナンス中です</title></head><body></body></html>`:      ErrMaintenance,
+		`<html><body><div class="h-captcha" data-sitekey="x"></div></body></html>`: ErrCaptcha,
+	}
+	for page, reason := range pages {
+		client := &MockClient{
+			DoFunc: withoutRobots(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(page))}, nil
+			}),
+		}
+		c, _ := NewCrawler(WithSettings(&Settings{RateLimit: -1}), WithHTTPClient(client))
+
+		// not an empty listing
+		listing, err := c.Search(context.Background(), BELLE_MAISON, "タオル", 1)
+		var blocked *BlockedError
+		if listing != nil || !errors.As(err, &blocked) || !errors.Is(err, reason) || Classify(err) != Transient {
+			t.Errorf("blocked page not detected: %+v, %v", listing, err)
+		}
+
+		// host paused
+		if _, err := c.Category(context.Background(), BELLE_MAISON, "1009", 1); !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("host not paused: %v", err)
+		}
+	}
+}
+
+func TestNormalizeProductCode(t *testing.T) {
+	tests := []struct {
+		input string
+		ref   *ProductRef
+	}{
+		{"1129250", &ProductRef{Site: BELLE_MAISON, ProductCode: "1129250"}},
+		{" 112925001001 ", &ProductRef{Site: BELLE_MAISON, ProductCode: "1129250", StyleCode: "01001"}},
+		{"https://www.bellemaison.jp/shop/commodity/0000/1129250/", &ProductRef{Site: BELLE_MAISON, ProductCode: "1129250"}},
+		{"https://www.bellemaison.jp/shop/commodity/0000/1129250?s=100000000001112118&utm_source=x",
+			&ProductRef{Site: BELLE_MAISON, ProductCode: "1129250", VariantID: "100000000001112118"}},
+		{"www.bellemaison.jp/shop/commodity/0000/1129250", &ProductRef{Site: BELLE_MAISON, ProductCode: "1129250"}},
+		{"112925", nil},
+		{"https://example.com/shop/commodity/0000/1129250", nil},
+		{"https://www.bellemaison.jp/shop/app/catalog/list/", nil},
+	}
+	for _, test := range tests {
+		ref, err := NormalizeProductCode(DEFAULT_SITE, test.input)
+		if test.ref == nil {
+			if !errors.Is(err, ErrInvalidProductCode) {
+				t.Errorf("%s: invalid input accepted: %+v", test.input, ref)
+			}
+			continue
+		}
+		if err != nil || *ref != *test.ref {
+			t.Errorf("%s: got %+v, %v, wanted %+v", test.input, ref, err, test.ref)
+		}
+	}
+
+	// style referred by sku or url found
+	file, _ := os.ReadFile("./test/success.html")
+	p, err := parseHTML(file, DefaultSelectors())
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	for _, input := range []string{"112925001001", "https://www.bellemaison.jp/shop/commodity/0000/1129250?s=100000000001112118"} {
+		ref, _ := NormalizeProductCode(DEFAULT_SITE, input)
+		if style := p.FindStyle(ref); style == nil || style.StyleCode != "01001" {
+			t.Errorf("%s: style not found", input)
+		}
+	}
+}
+
+func TestOptions_BaseURL(t *testing.T) {
+	// local fake site
+	html, _ := os.ReadFile("./test/success.html")
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		requested = r.URL.Path
+		w.Write(html)
+	}))
+	defer server.Close()
+
+	c, err := NewCrawler(WithSettings(&Settings{RateLimit: -1}), WithBaseURL(server.URL), WithUserAgent("test"))
+	if err != nil {
+		t.Fatalf("initializing crawler failed: %v", err)
+	}
+	r := c.Scraping(mockResult.ProductCode)[0]
+	if r.Err != nil || r.Product.Name != mockResult.Product.Name || requested != "/shop/commodity/0000/"+mockResult.ProductCode {
+		t.Errorf("request not sent to base url: %s, %v", requested, r.Err)
+	}
+
+	if _, err := NewCrawler(WithBaseURL("localhost")); err == nil {
+		t.Errorf("invalid base url accepted")
+	}
+	if _, err := NewCrawler(WithTimeout(0)); err == nil {
+		t.Errorf("invalid timeout accepted")
+	}
+}
+
+func TestOptions_ClientWrapper(t *testing.T) {
+	client := getMockClientwithFile("./test/success.html")
+	wrapped := []string{}
+	wrapper := func(name string) func(HTTPClient) HTTPClient {
+		return func(next HTTPClient) HTTPClient {
+			return &MockClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+				wrapped = append(wrapped, name)
+				return next.Do(req)
+			}}
+		}
+	}
+
+	c, err := NewCrawler(WithSettings(&Settings{IgnoreRobots: true}), WithHTTPClient(client),
+		WithClientWrapper(wrapper("inner")), WithClientWrapper(wrapper("outer")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := c.Scraping("1129250")[0]; r.Err != nil {
+		t.Fatalf("failed to scrape: %v", r.Err)
+	}
+	if !reflect.DeepEqual(wrapped, []string{"outer", "inner"}) {
+		t.Errorf("unexpected wrappers called: %v", wrapped)
+	}
+}
+
+func TestOptions_Order(t *testing.T) {
+	for _, opts := range [][]Option{
+		{WithTimeout(time.Second), WithUserAgent("a"), WithSettings(&Settings{RateLimit: -1, MaxRetries: -1})},
+		{WithSettings(&Settings{RateLimit: -1, MaxRetries: -1}), WithTimeout(time.Second), WithUserAgent("a")},
+	} {
+		c, err := NewCrawler(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := c.(*crawler).settings
+		if s.RequestTimeout != time.Second || !reflect.DeepEqual(s.UserAgents, []string{"a"}) ||
+			s.RateLimit != -1 || s.MaxRetries != -1 {
+			t.Errorf("options overridden: %+v", s)
+		}
+	}
+}
+
+func TestOptions_TLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("mock product"))
+	}))
+	defer server.Close()
+	RegisterSiteAdapter(&serverSite{url: server.URL})
+
+	settings := &Settings{RateLimit: -1, MaxRetries: -1, IgnoreRobots: true}
+
+	// certificate verified by default
+	c, _ := NewCrawler(WithSettings(settings))
+	if r := c.Scraping(JoinCode("server", "abc"))[0]; r.Err == nil {
+		t.Errorf("untrusted certificate accepted")
+	}
+
+	bundle := t.TempDir() + "/ca.pem"
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(bundle, cert, 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCrawler(WithSettings(settings), WithCABundle(bundle))
+	if err != nil {
+		t.Fatalf("initializing crawler failed: %v", err)
+	}
+	if r := c.Scraping(JoinCode("server", "abc"))[0]; r.Err != nil {
+		t.Errorf("certificate in CA bundle not trusted: %v", r.Err)
+	}
+
+	c, _ = NewCrawler(WithSettings(settings), WithTLSVerify(false))
+	if r := c.Scraping(JoinCode("server", "abc"))[0]; r.Err != nil {
+		t.Errorf("verification not turned off: %v", r.Err)
+	}
+
+	if _, err := NewCrawler(WithCABundle("./test/listing.html")); err == nil {
+		t.Errorf("invalid CA bundle accepted")
+	}
+}
+
+func TestParseStock(t *testing.T) {
+	now := time.Date(2023, 12, 15, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		description string
+		state       StockState
+		quantity    uint
+		date        string
+	}{
+		{"在庫あり", InStock, 0, ""},
+		{"在庫：3", LowStock, 3, ""},
+		{"売り切れ", SoldOut, 0, ""},
+		{"販売停止", Discontinued, 0, ""},
+		{"売り切れ（再入荷なし）", Discontinued, 0, ""},
+		{"12月20日入荷予定", Backorder, 0, "2023-12-20"},
+		{"1月10日入荷予定", Backorder, 0, "2024-01-10"},
+		{"入荷予定", Backorder, 0, ""},
+		{"", UnknownStock, 0, ""},
+	}
+
+	for _, test := range tests {
+		got := parseStock(test.description, now)
+		if got.State != test.state || got.Quantity != test.quantity {
+			t.Errorf("%q: got %+v, wanted %s %d", test.description, got, test.state, test.quantity)
+		}
+		date := ""
+		if got.ExpectedDate != nil {
+			date = got.ExpectedDate.Format("2006-01-02")
+		}
+		if date != test.date {
+			t.Errorf("%q: got restock date %q, wanted %q", test.description, date, test.date)
+		}
+	}
+}
+
+func TestDiscount(t *testing.T) {
+	tests := []struct{ regular, price, discount uint }{
+		{6578, 6578, 0},
+		{10000, 7000, 30},
+		{2990, 1990, 33},
+		{0, 1990, 0},
+	}
+	for _, test := range tests {
+		if got := discount(test.regular, test.price); got != test.discount {
+			t.Errorf("discount(%d, %d) = %d, wanted %d", test.regular, test.price, got, test.discount)
+		}
+	}
+}
+
+func TestSplitCode(t *testing.T) {
+	if site, code := SplitCode("1129250"); site != DEFAULT_SITE || code != "1129250" {
+		t.Errorf("got %s, %s", site, code)
+	}
+	if site, code := SplitCode(JoinCode("mock", "abc")); site != "mock" || code != "abc" {
+		t.Errorf("got %s, %s", site, code)
+	}
+	if JoinCode(DEFAULT_SITE, "1129250") != "1129250" {
+		t.Errorf("product code of default site should not be qualified")
+	}
+}
+
 func getMockClientwithFile(name string) *MockClient {
 	// getMockHtmlPage()
 
@@ -135,7 +1659,7 @@ var mockResult = &Result{
 	Product: &Product{
 		Name: "シートマッサージャー",
 		Styles: []Style{
-			{StyleCode: "01001", ImageUrl: "https://pic2.bellemaison.jp/shop/cms/images/0000/catalog/1129250/1129250_h1_001.jpg", Colour: "Standard", Size: "Standard", Price: 6578, Stock: 4},
+			{StyleCode: "01001", ImageUrl: "https://pic2.bellemaison.jp/shop/cms/images/0000/catalog/1129250/1129250_h1_001.jpg", Colour: "Standard", Size: "Standard", Price: 6578, RegularPrice: 6578, Points: 30, Stock: StockStatus{State: LowStock, Quantity: 3}},
 		},
 	},
 	Err: nil,
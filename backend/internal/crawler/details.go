@@ -0,0 +1,102 @@
+package crawler
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	lineBreakPattern = regexp.MustCompile(`(?i)<br\s*/?>`)
+	tagPattern       = regexp.MustCompile(`<[^>]*>`)
+)
+
+const (
+	specBullets   = "●・■" // leading marks of spec items in description
+	specSeparator = "／"   // between name and value, i.e. 本体重量／約1.3kg
+)
+
+// htmlText converts html fragment to plain text, <br> is kept as new line
+// and empty lines are removed
+func htmlText(fragment string) string {
+	fragment = lineBreakPattern.ReplaceAllString(fragment, "\n")
+	fragment = html.UnescapeString(tagPattern.ReplaceAllString(fragment, ""))
+
+	lines := []string{}
+	for _, line := range strings.Split(fragment, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseSpecs returns spec items of description, which are lines start with
+// a bullet, i.e. "●本体重量／約1.3kg". Name is empty if not separated.
+func parseSpecs(description string) []Spec {
+	specs := []Spec{}
+	for _, line := range strings.Split(description, "\n") {
+		item := strings.TrimLeft(line, specBullets)
+		if item == line {
+			continue
+		}
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if name, value, ok := strings.Cut(item, specSeparator); ok {
+			specs = append(specs, Spec{Name: strings.TrimSpace(name), Value: strings.TrimSpace(value)})
+			continue
+		}
+		specs = append(specs, Spec{Value: item})
+	}
+	return specs
+}
+
+// parseSpecTable returns rows of spec tables, name in th and value in td
+func parseSpecTable(page *goquery.Document, selector string) []Spec {
+	specs := []Spec{}
+	page.Find(selector).Find("tr").Each(func(i int, s *goquery.Selection) {
+		name := strings.TrimSpace(s.Find("th").First().Text())
+		value, _ := s.Find("td").First().Html()
+		if value = htmlText(value); value != "" {
+			specs = append(specs, Spec{Name: name, Value: value})
+		}
+	})
+	return specs
+}
+
+// parseBreadcrumb returns categories of the links selected,
+// links without category id, i.e. top page, are ignored
+func parseBreadcrumb(page *goquery.Document, selector string, categoryID func(link string) string) []Category {
+	categories := []Category{}
+	page.Find(selector).Each(func(i int, s *goquery.Selection) {
+		id := categoryID(s.AttrOr("href", ""))
+		if id == "" {
+			return
+		}
+		categories = append(categories, Category{ID: id, Name: strings.TrimSpace(s.Text())})
+	})
+	return categories
+}
+
+// extractDetails extracts brand, description, specs and breadcrumb with
+// the selectors, items without selector are skipped
+func extractDetails(p *Product, page *goquery.Document, sel *Selectors, categoryID func(link string) string) {
+	if sel.Brand != "" {
+		p.Brand = strings.TrimSpace(page.Find(sel.Brand).First().Text())
+	}
+	if sel.Description != "" {
+		description, _ := page.Find(sel.Description).First().Html()
+		p.Description = htmlText(description)
+		p.Specs = parseSpecs(p.Description)
+	}
+	if sel.SpecTable != "" {
+		p.Specs = append(p.Specs, parseSpecTable(page, sel.SpecTable)...)
+	}
+	if sel.Breadcrumb != "" {
+		p.Breadcrumb = parseBreadcrumb(page, sel.Breadcrumb, categoryID)
+	}
+}
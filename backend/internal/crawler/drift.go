@@ -0,0 +1,111 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+var ErrParseDrift = errors.New("parser drift detected")
+
+// StyleDropRatio is the share of styles allowed to disappear at once,
+// more than that is considered as parser drift rather than product change
+// until the same number of styles is observed StyleDropConfirmations times in a row
+const (
+	StyleDropRatio         = 0.5
+	StyleDropConfirmations = 3
+)
+
+// DriftError is returned when the page parsed without error but the
+// product looks wrong, most likely the markup of the site changed
+type DriftError struct {
+	Reason string
+}
+
+func (e *DriftError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrParseDrift, e.Reason)
+}
+
+func (e *DriftError) Is(target error) bool {
+	return target == ErrParseDrift
+}
+
+func (e *DriftError) Class() ErrorClass {
+	return Permanent
+}
+
+// CheckDrift runs sanity checks on the product parsed, knownStyles is the
+// number of styles known before, i.e. stored in db, 0 if unknown.
+// *DriftError will be returned if any check failed.
+func CheckDrift(p *Product, knownStyles int) error {
+	if p == nil {
+		return &DriftError{Reason: "no product parsed"}
+	}
+	if p.Name == "" {
+		return &DriftError{Reason: "product name missing"}
+	}
+	if len(p.Styles) == 0 {
+		return &DriftError{Reason: "no style found"}
+	}
+	// styles of zero price are rejected by RejectImplausible, but not all of them
+	priced := 0
+	for _, style := range p.Styles {
+		if style.Price > 0 {
+			priced++
+		}
+	}
+	if priced == 0 {
+		return &DriftError{Reason: "no style has price"}
+	}
+	if StyleDropped(knownStyles, len(p.Styles)) {
+		return &DriftError{Reason: fmt.Sprintf("styles dropped from %d to %d", knownStyles, len(p.Styles))}
+	}
+	return nil
+}
+
+// StyleDropped returns true if more than StyleDropRatio of styles known disappeared
+func StyleDropped(knownStyles, styles int) bool {
+	return knownStyles > 1 && float64(knownStyles-styles) > float64(knownStyles)*StyleDropRatio
+}
+
+// styleDrops counts style drops observed in a row of each product
+type styleDrops struct {
+	mu   sync.Mutex
+	seen map[string]styleDrop // key = product code
+}
+
+type styleDrop struct {
+	styles int // number of styles dropped to
+	count  int // observations in a row
+}
+
+func newStyleDrops() *styleDrops {
+	return &styleDrops{seen: map[string]styleDrop{}}
+}
+
+// check returns *DriftError if styles of the product dropped, the drop is
+// accepted as product change once observed StyleDropConfirmations times in a row
+func (d *styleDrops) check(code string, knownStyles, styles int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !StyleDropped(knownStyles, styles) {
+		delete(d.seen, code)
+		return nil
+	}
+
+	drop := d.seen[code]
+	if drop.styles != styles {
+		drop = styleDrop{styles: styles}
+	}
+	drop.count++
+	if drop.count >= StyleDropConfirmations {
+		delete(d.seen, code)
+		log.Printf("%s: styles dropped from %d to %d %d times in a row, accepted", code, knownStyles, styles, drop.count)
+		return nil
+	}
+	d.seen[code] = drop
+	return &DriftError{Reason: fmt.Sprintf("styles dropped from %d to %d, %d of %d observations to accept",
+		knownStyles, styles, drop.count, StyleDropConfirmations)}
+}
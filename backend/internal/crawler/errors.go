@@ -0,0 +1,151 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrorClass tells callers how to handle a failed result
+type ErrorClass int
+
+const (
+	NoError   ErrorClass = iota
+	Transient            // may succeed later, i.e. timeout, 5xx, 429
+	Permanent            // retrying will not help, i.e. 404, parse failure
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case NoError:
+		return "none"
+	case Transient:
+		return "transient"
+	case Permanent:
+		return "permanent"
+	default:
+		return "unknown"
+	}
+}
+
+func (c ErrorClass) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// classifier is implemented by errors knowing their class
+type classifier interface {
+	Class() ErrorClass
+}
+
+// Classify returns the class of err,
+// errors not recognized are considered as Transient
+func Classify(err error) ErrorClass {
+	if err == nil {
+		return NoError
+	}
+
+	var c classifier
+	if errors.As(err, &c) {
+		return c.Class()
+	}
+
+	if errors.Is(err, PRODUCT_NOT_FOUND) || errors.Is(err, ErrUnknownSite) ||
+		errors.Is(err, ErrNotRecorded) || errors.Is(err, ErrDisallowed) ||
+		errors.Is(err, ErrListingNotSupported) || errors.Is(err, ErrResponseTooLarge) {
+		return Permanent
+	}
+
+	// i.e. network errors, timeout
+	return Transient
+}
+
+// FetchError is returned when the page cannot be fetched
+type FetchError struct {
+	URL        string
+	StatusCode int           // 0 if no response received
+	RetryAfter time.Duration // value of Retry-After header, if any
+	Err        error         // underlying error if no response received
+}
+
+func (e *FetchError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("fetch %s: %v", e.URL, e.Err)
+	}
+	return fmt.Sprintf("fetch %s: %d %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Class returns class of the underlying error if no response received,
+// Transient for 408, 429 and 5xx, Permanent for other status codes
+func (e *FetchError) Class() ErrorClass {
+	switch {
+	case e.StatusCode == 0 && e.Err != nil:
+		return Classify(e.Err)
+	case e.StatusCode == 0:
+		return Transient
+	case e.StatusCode == http.StatusRequestTimeout,
+		e.StatusCode == http.StatusTooManyRequests,
+		e.StatusCode >= 500:
+		return Transient
+	default:
+		return Permanent
+	}
+}
+
+// ParseError is returned when the page fetched cannot be parsed
+type ParseError struct {
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("parse: %v", e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ParseError) Class() ErrorClass {
+	return Permanent
+}
+
+// parseRetryAfter parses Retry-After header in seconds or http date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// backoff returns the delay before retry attempt n (starts from 0),
+// it grows exponentially from base up to max with random jitter
+func backoff(n int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 0; i < n && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	// equal jitter: half fixed, half random
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
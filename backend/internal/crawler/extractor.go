@@ -0,0 +1,125 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	EXTRACTOR_JSONLD = "jsonld" // structured data embedded in the page
+	EXTRACTOR_DOM    = "dom"    // attributes of html elements
+)
+
+// Extractor extracts product from the page, it returns
+// the product found or error if nothing can be found
+type Extractor struct {
+	Name    string
+	Extract func(page *goquery.Document) (*Product, error)
+}
+
+// Extract runs the extractors in order, the first product extracted is used
+// and completed by the products extracted by the rest of extractors.
+// Products extracted are cross-validated, *DriftError will be returned
+// if they disagree on the price of a style.
+func Extract(page *goquery.Document, extractors ...Extractor) (*Product, error) {
+	var product *Product
+	var errs []error
+	for _, e := range extractors {
+		p, err := e.Extract(page)
+		if err == nil {
+			err = CheckDrift(p, 0)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", e.Name, err))
+			continue
+		}
+
+		if product == nil {
+			p.Extractor = e.Name
+			product = p
+			continue
+		}
+		if err := crossValidate(product, p); err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Name, err)
+		}
+		merge(product, p)
+	}
+
+	if product == nil {
+		return nil, errors.Join(errs...)
+	}
+	return product, nil
+}
+
+// crossValidate checks are the prices of styles found by both the same
+func crossValidate(p, other *Product) error {
+	for _, style := range other.Styles {
+		// zero if not parsed, rejected later
+		if s := p.style(style.StyleCode); s != nil && s.Price != style.Price && s.Price != 0 && style.Price != 0 {
+			return &DriftError{Reason: fmt.Sprintf("price of style %s not match, %s: %d, other: %d",
+				style.StyleCode, p.Extractor, s.Price, style.Price)}
+		}
+	}
+	return nil
+}
+
+// merge fills the fields of p not provided by its extractor with other,
+// styles not found by its extractor will be added
+func merge(p, other *Product) {
+	fillString(&p.Name, other.Name)
+	fillString(&p.Brand, other.Brand)
+	fillString(&p.Description, other.Description)
+	if len(p.Breadcrumb) == 0 {
+		p.Breadcrumb = other.Breadcrumb
+	}
+	if len(p.Specs) == 0 {
+		p.Specs = other.Specs
+	}
+
+	for _, style := range other.Styles {
+		s := p.style(style.StyleCode)
+		if s == nil {
+			p.Styles = append(p.Styles, style)
+			continue
+		}
+
+		fillString(&s.VariantID, style.VariantID)
+		fillString(&s.RawPrice, style.RawPrice)
+		fillString(&s.ImageUrl, style.ImageUrl)
+		fillString(&s.Colour, style.Colour)
+		fillString(&s.Size, style.Size)
+		fillUint(&s.RegularPrice, style.RegularPrice)
+		fillUint(&s.SalePrice, style.SalePrice)
+		fillUint(&s.Discount, style.Discount)
+		fillUint(&s.Points, style.Points)
+
+		// other may know more, i.e. quantity left, if it agrees on availability
+		if style.Stock.known() && (!s.Stock.known() || s.Stock.Available() == style.Stock.Available()) {
+			s.Stock = style.Stock
+		}
+	}
+}
+
+// style returns style with the code, nil if not found
+func (p *Product) style(styleCode string) *Style {
+	for i := range p.Styles {
+		if p.Styles[i].StyleCode == styleCode {
+			return &p.Styles[i]
+		}
+	}
+	return nil
+}
+
+func fillString(dst *string, value string) {
+	if *dst == "" {
+		*dst = value
+	}
+}
+
+func fillUint(dst *uint, value uint) {
+	if *dst == 0 {
+		*dst = value
+	}
+}
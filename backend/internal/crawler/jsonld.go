@@ -0,0 +1,137 @@
+package crawler
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ldObject is a JSON-LD object, keys are in lower case
+// as the sites are not consistent, i.e. "Offers" and "offers"
+type ldObject map[string]interface{}
+
+// ldObjectsOf returns schema.org objects of the type embedded in
+// the elements selected, objects cannot be decoded are ignored
+func ldObjectsOf(page *goquery.Document, selector, objectType string) []ldObject {
+	objects := []ldObject{}
+	page.Find(selector).Each(func(i int, s *goquery.Selection) {
+		var data interface{}
+		if err := json.Unmarshal([]byte(s.Text()), &data); err != nil {
+			return
+		}
+		for _, obj := range ldObjects(data) {
+			if obj.str("@type") == objectType {
+				objects = append(objects, obj)
+			}
+		}
+	})
+	return objects
+}
+
+// ldObjects flattens arrays and @graph into objects
+func ldObjects(data interface{}) []ldObject {
+	switch v := data.(type) {
+	case []interface{}:
+		objects := []ldObject{}
+		for _, item := range v {
+			objects = append(objects, ldObjects(item)...)
+		}
+		return objects
+	case map[string]interface{}:
+		obj := ldObject{}
+		for key, value := range v {
+			obj[strings.ToLower(key)] = value
+		}
+		if graph, ok := obj["@graph"]; ok {
+			return ldObjects(graph)
+		}
+		return []ldObject{obj}
+	default:
+		return nil
+	}
+}
+
+// str returns value of the key as string, the first one if it is an array
+func (o ldObject) str(key string) string {
+	switch v := o[key].(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		if len(v) > 0 {
+			return ldObject{key: v[0]}.str(key)
+		}
+	}
+	return ""
+}
+
+// list returns value of the key as objects
+func (o ldObject) list(key string) []ldObject {
+	return ldObjects(o[key])
+}
+
+// obj returns value of the key as object, the first one if it is an array
+func (o ldObject) obj(key string) ldObject {
+	objects := ldObjects(o[key])
+	if len(objects) == 0 {
+		return ldObject{}
+	}
+	return objects[0]
+}
+
+// ldBrand returns name of brand, which is either a string or a Brand object
+func ldBrand(o ldObject) string {
+	if brand := o.str("brand"); brand != "" {
+		return brand
+	}
+	return o.obj("brand").str("name")
+}
+
+// ldBreadcrumb returns categories of BreadcrumbList objects in position order,
+// items without category id, i.e. top page and product itself, are ignored
+func ldBreadcrumb(page *goquery.Document, selector string, categoryID func(link string) string) []Category {
+	categories := []Category{}
+	for _, list := range ldObjectsOf(page, selector, "BreadcrumbList") {
+		items := list.list("itemlistelement")
+		sort.SliceStable(items, func(i, j int) bool {
+			pi, _ := strconv.Atoi(items[i].str("position"))
+			pj, _ := strconv.Atoi(items[j].str("position"))
+			return pi < pj
+		})
+		for _, item := range items {
+			// item is either an url or a Thing
+			link, name := item.str("item"), item.str("name")
+			if thing := item.obj("item"); len(thing) > 0 {
+				link = thing.str("@id")
+				fillString(&name, thing.str("name"))
+			}
+			if id := categoryID(link); id != "" {
+				categories = append(categories, Category{ID: id, Name: name})
+			}
+		}
+	}
+	return categories
+}
+
+// ldAvailability converts schema.org ItemAvailability to StockStatus
+func ldAvailability(availability string) StockStatus {
+	availability = availability[strings.LastIndex(availability, "/")+1:]
+	switch availability {
+	case "InStock", "InStoreOnly", "OnlineOnly":
+		return StockStatus{State: InStock}
+	case "LimitedAvailability":
+		return StockStatus{State: LowStock}
+	case "OutOfStock", "SoldOut":
+		return StockStatus{State: SoldOut}
+	case "Discontinued":
+		return StockStatus{State: Discontinued}
+	case "BackOrder", "PreOrder", "PreSale":
+		return StockStatus{State: Backorder}
+	default:
+		return StockStatus{State: UnknownStock}
+	}
+}
@@ -0,0 +1,94 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrListingNotSupported = errors.New("site does not support listing")
+
+// Listing is a page of category or search result
+type Listing struct {
+	Site     string
+	Page     int // starts from 1
+	HasNext  bool
+	Products []ListingItem
+}
+
+// ListingItem is summary of a product in listing
+type ListingItem struct {
+	ProductCode string // qualified by site, see JoinCode
+	Name        string
+	ImageUrl    string
+	Price       uint // lowest price of the styles, 0 if not shown
+}
+
+// Lister is implemented by site adapters support
+// category and search result listing pages
+type Lister interface {
+	// SearchURL returns the url of page of search result, page starts from 1
+	SearchURL(query string, page int) string
+	// CategoryURL returns the url of page of category, page starts from 1
+	CategoryURL(categoryID string, page int) string
+	// ValidateCategoryID checks is the category id valid for the site
+	ValidateCategoryID(categoryID string) bool
+	// ParseListing converts listing page to Listing struct, product codes
+	// returned are not qualified by site. *BlockedError is returned if the
+	// site served a maintenance, captcha or anti-bot page instead.
+	ParseListing(html []byte) (*Listing, error)
+}
+
+// Search fetches page of search result of the site, page starts from 1
+func (c *crawler) Search(ctx context.Context, site, query string, page int) (*Listing, error) {
+	lister, err := getLister(site)
+	if err != nil {
+		return nil, err
+	}
+	return c.list(ctx, site, lister, lister.SearchURL(query, page), page)
+}
+
+// Category fetches page of category of the site, page starts from 1
+func (c *crawler) Category(ctx context.Context, site, categoryID string, page int) (*Listing, error) {
+	lister, err := getLister(site)
+	if err != nil {
+		return nil, err
+	}
+	return c.list(ctx, site, lister, lister.CategoryURL(categoryID, page), page)
+}
+
+// getLister returns adapter of the site as Lister
+func getLister(site string) (Lister, error) {
+	adapter, ok := GetSiteAdapter(site)
+	if !ok {
+		return nil, ErrUnknownSite
+	}
+	lister, ok := adapter.(Lister)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", site, ErrListingNotSupported)
+	}
+	return lister, nil
+}
+
+func (c *crawler) list(ctx context.Context, site string, lister Lister, link string, page int) (*Listing, error) {
+	p, err := c.get(ctx, link, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	listing, err := lister.ParseListing(p.data)
+	var blocked *BlockedError
+	if errors.As(err, &blocked) {
+		return nil, c.blocked(&response{link: link}, err)
+	}
+	if err != nil {
+		return nil, &ParseError{Err: err}
+	}
+
+	listing.Site = site
+	listing.Page = page
+	for i := range listing.Products {
+		listing.Products[i].ProductCode = JoinCode(site, listing.Products[i].ProductCode)
+	}
+	return listing, nil
+}
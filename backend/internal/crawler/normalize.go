@@ -0,0 +1,95 @@
+package crawler
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalidProductCode = errors.New("invalid product code")
+
+// ProductRef is a product, and its style if known, referred by user input
+type ProductRef struct {
+	Site        string
+	ProductCode string
+	StyleCode   string // i.e. from sku, empty if not known
+	VariantID   string // i.e. from url, empty if not known
+}
+
+// Normalizer is implemented by site adapters accept inputs other
+// than product code, i.e. url of product page or sku
+type Normalizer interface {
+	// Normalize returns product referred by input, site of
+	// ProductRef is not required. It returns false if not accepted.
+	Normalize(input string) (*ProductRef, bool)
+}
+
+// NormalizeProductCode converts user input to ProductRef. Urls are accepted
+// by the site they belong to, other inputs by the site provided.
+// ErrInvalidProductCode will be returned if not accepted.
+func NormalizeProductCode(site, input string) (*ProductRef, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil, ErrInvalidProductCode
+	}
+
+	if isURL(input) {
+		for _, name := range Sites() {
+			adapter, _ := GetSiteAdapter(name)
+			if n, ok := adapter.(Normalizer); ok {
+				if ref, ok := n.Normalize(input); ok {
+					ref.Site = name
+					return ref, nil
+				}
+			}
+		}
+		return nil, ErrInvalidProductCode
+	}
+
+	adapter, ok := GetSiteAdapter(site)
+	if !ok {
+		return nil, ErrUnknownSite
+	}
+	if n, ok := adapter.(Normalizer); ok {
+		if ref, ok := n.Normalize(input); ok {
+			ref.Site = site
+			return ref, nil
+		}
+		return nil, ErrInvalidProductCode
+	}
+	if !adapter.ValidateProductCode(input) {
+		return nil, ErrInvalidProductCode
+	}
+	return &ProductRef{Site: site, ProductCode: input}, nil
+}
+
+// isURL returns true if input looks like url, scheme may be omitted
+func isURL(input string) bool {
+	return strings.Contains(input, "://") || strings.Contains(input, "/")
+}
+
+// StyleByName returns style of the colour and size, nil if not found. The only
+// style is returned if both are empty, i.e. not provided by structured data.
+func (p *Product) StyleByName(colour, size string) *Style {
+	for i := range p.Styles {
+		style := &p.Styles[i]
+		if style.Colour == colour && style.Size == size {
+			return style
+		}
+	}
+	if colour == "" && size == "" && len(p.Styles) == 1 {
+		return &p.Styles[0]
+	}
+	return nil
+}
+
+// FindStyle returns style referred by ref, nil if not found or no style referred
+func (p *Product) FindStyle(ref *ProductRef) *Style {
+	for i := range p.Styles {
+		style := &p.Styles[i]
+		if ref.StyleCode != "" && style.StyleCode == ref.StyleCode ||
+			ref.VariantID != "" && style.VariantID == ref.VariantID {
+			return style
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package crawler
+
+import (
+	"regexp"
+	"strings"
+)
+
+// reasons of observations rejected
+const (
+	REJECT_ZERO_PRICE     = "zero price"
+	REJECT_NEGATIVE_PRICE = "negative price"
+	REJECT_INVALID_PRICE  = "invalid price"
+	REJECT_PRICE_JUMP     = "price jump"
+)
+
+// MaxPriceJump is the ratio between the last price accepted and the price
+// observed beyond which the observation is rejected, i.e. parsed wrongly
+const MaxPriceJump = 10
+
+var negativePricePattern = regexp.MustCompile(`^-\s*[\d,]+$`)
+
+// CheckObservation returns reason the style is implausible, or empty if
+// accepted. lastPrice is the last price accepted of the style, 0 if unknown.
+func CheckObservation(style *Style, lastPrice uint) string {
+	raw := strings.TrimSpace(style.RawPrice)
+	switch {
+	case style.Price == 0 && negativePricePattern.MatchString(raw):
+		return REJECT_NEGATIVE_PRICE
+	case style.Price == 0 && raw != "" && strings.Trim(raw, "0,") != "":
+		return REJECT_INVALID_PRICE
+	case style.Price == 0:
+		return REJECT_ZERO_PRICE
+	case lastPrice > 0 && (style.Price > lastPrice*MaxPriceJump || style.Price*MaxPriceJump < lastPrice):
+		return REJECT_PRICE_JUMP
+	}
+	return ""
+}
+
+// RejectImplausible returns copy of the product with styles implausible marked
+// as Rejected and number of styles rejected, the product is not modified as it
+// may be shared, i.e. cached. lastPrice returns the last price accepted of the
+// style, 0 if unknown, prices are not compared if nil.
+func RejectImplausible(p *Product, lastPrice func(style *Style) uint) (*Product, int) {
+	if p == nil {
+		return nil, 0
+	}
+
+	checked := *p
+	checked.Styles = make([]Style, len(p.Styles))
+	copy(checked.Styles, p.Styles)
+
+	rejected := 0
+	for i := range checked.Styles {
+		style := &checked.Styles[i]
+		last := uint(0)
+		if lastPrice != nil {
+			last = lastPrice(style)
+		}
+		style.Rejected = CheckObservation(style, last)
+		if style.Rejected != "" {
+			rejected++
+		}
+	}
+	return &checked, rejected
+}
+
+// Accepted returns styles not rejected
+func (p *Product) Accepted() []Style {
+	styles := make([]Style, 0, len(p.Styles))
+	for _, style := range p.Styles {
+		if style.Rejected == "" {
+			styles = append(styles, style)
+		}
+	}
+	return styles
+}
+
+// acceptedPrice returns price of the style last accepted, 0 if unknown
+func (p *Product) acceptedPrice(style *Style) uint {
+	if s := p.style(style.StyleCode); s != nil && s.Rejected == "" {
+		return s.Price
+	}
+	return 0
+}
@@ -0,0 +1,145 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Option configures the crawler created by NewCrawler
+type Option func(*options) error
+
+// options are collected before the crawler is created
+type options struct {
+	settings   Settings
+	httpClient HTTPClient // nil for default http client
+	baseURL    *url.URL   // nil if requests are sent to the sites
+	rootCAs    *x509.CertPool
+	skipVerify bool
+	wrappers   []func(HTTPClient) HTTPClient // applied to the client in order
+	overrides  []func(*Settings)             // applied to settings after WithSettings
+}
+
+// WithSettings configures the crawler by settings,
+// zero values will be replaced by defaults. Options changing
+// settings, i.e. WithTimeout, take precedence whatever the order.
+func WithSettings(settings *Settings) Option {
+	return func(o *options) error {
+		o.settings = settings.withDefaults()
+		return nil
+	}
+}
+
+// WithHTTPClient replaces the default http client,
+// options of the default http client will not be applied to it
+func WithHTTPClient(client HTTPClient) Option {
+	return func(o *options) error {
+		if o.httpClient != nil {
+			return ErrMultipleClient
+		}
+		o.httpClient = client
+		return nil
+	}
+}
+
+// WithClientWrapper wraps the http client, default or provided, after all
+// other options applied, i.e. to inspect the responses received
+func WithClientWrapper(wrap func(HTTPClient) HTTPClient) Option {
+	return func(o *options) error {
+		o.wrappers = append(o.wrappers, wrap)
+		return nil
+	}
+}
+
+// WithTimeout sets deadline of each http request
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) error {
+		if timeout <= 0 {
+			return fmt.Errorf("invalid timeout: %v", timeout)
+		}
+		o.overrides = append(o.overrides, func(s *Settings) { s.RequestTimeout = timeout })
+		return nil
+	}
+}
+
+// WithBaseURL sends requests to baseURL instead of the sites,
+// path and query of the pages are kept, i.e. a local fake site
+func WithBaseURL(baseURL string) Option {
+	return func(o *options) error {
+		u, err := url.Parse(baseURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid base url: %s", baseURL)
+		}
+		o.baseURL = u
+		return nil
+	}
+}
+
+// WithCABundle trusts certificates in the PEM file in addition
+// to the system ones, i.e. certificate of proxy or local site
+func WithCABundle(path string) Option {
+	return func(o *options) error {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read CA bundle: %v", err)
+		}
+
+		if o.rootCAs == nil {
+			if o.rootCAs, err = x509.SystemCertPool(); err != nil {
+				o.rootCAs = x509.NewCertPool()
+			}
+		}
+		if !o.rootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in CA bundle: %s", path)
+		}
+		return nil
+	}
+}
+
+// WithTLSVerify turns verification of certificates on or off,
+// it is on by default. Never turn it off in production.
+func WithTLSVerify(verify bool) Option {
+	return func(o *options) error {
+		o.skipVerify = !verify
+		return nil
+	}
+}
+
+// WithUserAgent sets user agents sent, they will be rotated in turn
+func WithUserAgent(userAgents ...string) Option {
+	return func(o *options) error {
+		if len(userAgents) == 0 {
+			return fmt.Errorf("no user agent provided")
+		}
+		o.overrides = append(o.overrides, func(s *Settings) { s.UserAgents = userAgents })
+		return nil
+	}
+}
+
+// tlsConfig returns tls config of the default http client
+func (o *options) tlsConfig() *tls.Config {
+	return &tls.Config{
+		RootCAs:            o.rootCAs, // system pool if nil
+		InsecureSkipVerify: o.skipVerify,
+	}
+}
+
+// rebase returns link with scheme and host replaced by baseURL
+func (o *options) rebase(link string) string {
+	if o.baseURL == nil {
+		return link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	u.Scheme = o.baseURL.Scheme
+	u.Host = o.baseURL.Host
+	u.Path = strings.TrimSuffix(o.baseURL.Path, "/") + u.Path
+	u.RawPath = ""
+	return u.String()
+}
@@ -0,0 +1,174 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	PROXY_ROUND_ROBIN  = "round_robin"
+	PROXY_LEAST_ERRORS = "least_errors" // lowest error rate first
+)
+
+var ErrNoProxy = errors.New("no proxy available")
+
+// proxy is a proxy server and its health
+type proxy struct {
+	url          *url.URL
+	requests     int
+	errors       int
+	failures     int       // consecutive failures
+	evictedUntil time.Time // taken out of rotation until then
+}
+
+// errorRate returns share of requests failed
+func (p *proxy) errorRate() float64 {
+	if p.requests == 0 {
+		return 0
+	}
+	return float64(p.errors) / float64(p.requests)
+}
+
+// proxyPool picks proxy for each request and tracks their health,
+// proxies failed maxFailures times in a row are evicted for cooldown
+type proxyPool struct {
+	mu          sync.Mutex
+	proxies     []*proxy
+	strategy    string
+	next        int
+	maxFailures int
+	cooldown    time.Duration
+}
+
+// newProxyPool returns pool of the proxy urls, http, https, socks5 and socks5h are supported
+func newProxyPool(urls []string, strategy string, maxFailures int, cooldown time.Duration) (*proxyPool, error) {
+	switch strategy {
+	case PROXY_ROUND_ROBIN, PROXY_LEAST_ERRORS:
+	case "":
+		strategy = PROXY_ROUND_ROBIN
+	default:
+		return nil, fmt.Errorf("unknown proxy strategy: %s", strategy)
+	}
+
+	pool := &proxyPool{
+		proxies:     make([]*proxy, 0, len(urls)),
+		strategy:    strategy,
+		maxFailures: maxFailures,
+		cooldown:    cooldown,
+	}
+	for _, rawURL := range urls {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %s: %v", rawURL, err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		case "socks5h":
+			// net/http knows socks5h since go 1.22, its socks5
+			// lets the proxy resolve host names anyway
+			u.Scheme = "socks5"
+		default:
+			return nil, fmt.Errorf("invalid proxy %s: scheme %q not supported", rawURL, u.Scheme)
+		}
+		pool.proxies = append(pool.proxies, &proxy{url: u})
+	}
+	return pool, nil
+}
+
+// pick returns proxy for next request, ErrNoProxy if all evicted
+func (p *proxyPool) pick(now time.Time) (*proxy, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// scan from the one next to last picked, so proxies
+	// of the same error rate are picked in turn
+	var picked *proxy
+	pickedIdx := 0
+	size := len(p.proxies)
+	for i := 0; i < size; i++ {
+		idx := (p.next + i) % size
+		candidate := p.proxies[idx]
+		if now.Before(candidate.evictedUntil) {
+			continue
+		}
+		if picked == nil || p.strategy == PROXY_LEAST_ERRORS && candidate.errorRate() < picked.errorRate() {
+			picked, pickedIdx = candidate, idx
+			if p.strategy == PROXY_ROUND_ROBIN {
+				break
+			}
+		}
+	}
+
+	if picked == nil {
+		return nil, ErrNoProxy
+	}
+	p.next = pickedIdx + 1
+	picked.requests++
+	return picked, nil
+}
+
+// report records result of request sent through the proxy
+func (p *proxyPool) report(px *proxy, failed bool, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !failed {
+		px.failures = 0
+		return
+	}
+
+	px.errors++
+	px.failures++
+	if px.failures >= p.maxFailures {
+		px.failures = 0
+		px.evictedUntil = now.Add(p.cooldown)
+		log.Printf("proxy %s failed %d times, taken out of rotation until %s",
+			px.url.Redacted(), p.maxFailures, px.evictedUntil.Format(time.RFC3339))
+	}
+}
+
+type proxyKey struct{}
+
+// proxyOf is used as http.Transport.Proxy, it returns the proxy picked for the request
+func proxyOf(req *http.Request) (*url.URL, error) {
+	if px, ok := req.Context().Value(proxyKey{}).(*proxy); ok {
+		return px.url, nil
+	}
+	return nil, nil
+}
+
+// proxyClient implements HTTPClient, it sends each request
+// through a proxy picked from the pool
+type proxyClient struct {
+	client HTTPClient // transport must use proxyOf
+	pool   *proxyPool
+}
+
+func (c *proxyClient) Do(req *http.Request) (*http.Response, error) {
+	px, err := c.pool.pick(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.client.Do(req.WithContext(context.WithValue(req.Context(), proxyKey{}, px)))
+
+	// cancelled by caller, not the fault of proxy
+	if err != nil && req.Context().Err() != nil {
+		return res, err
+	}
+	c.pool.report(px, err != nil || proxyFailed(res.StatusCode), time.Now())
+	return res, err
+}
+
+// proxyFailed returns true if the status code suggests the proxy is rejected or blocked
+func proxyFailed(statusCode int) bool {
+	return statusCode == http.StatusProxyAuthRequired ||
+		statusCode == http.StatusForbidden ||
+		statusCode == http.StatusTooManyRequests
+}
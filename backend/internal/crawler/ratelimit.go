@@ -0,0 +1,117 @@
+package crawler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tokenBucket allows rate requests per second with bursts of up to burst requests
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token from the bucket and returns
+// how long the caller has to wait before using it
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// wait blocks until a token is available or ctx is done
+func (b *tokenBucket) wait(ctx context.Context) error {
+	d := b.reserve()
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// hostLimiter keeps a token bucket for each host
+type hostLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   int
+	buckets map[string]*tokenBucket
+}
+
+// newHostLimiter returns limiter allows rate requests per second per host,
+// no limit will be applied if rate <= 0 unless delay set for the host
+func newHostLimiter(rate float64, burst int) *hostLimiter {
+	return &hostLimiter{
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// wait blocks until request to host is allowed or ctx is done
+func (l *hostLimiter) wait(ctx context.Context, host string) error {
+	l.mu.Lock()
+	b, ok := l.buckets[host]
+	if !ok {
+		if l.rate <= 0 {
+			l.mu.Unlock()
+			return ctx.Err()
+		}
+		b = newTokenBucket(l.rate, l.burst)
+		l.buckets[host] = b
+	}
+	l.mu.Unlock()
+
+	return b.wait(ctx)
+}
+
+// setDelay slows requests to host down to one per delay, i.e. Crawl-delay,
+// it is ignored if the limit is stricter already
+func (l *hostLimiter) setDelay(host string, delay time.Duration) {
+	rate := 1 / delay.Seconds()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.buckets[host]; ok && b.rate <= rate {
+		return
+	}
+	if l.rate > 0 && l.rate <= rate {
+		return
+	}
+	l.buckets[host] = newTokenBucket(rate, 1)
+}
@@ -0,0 +1,289 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	robotsTTL     = 24 * time.Hour
+	robotsMaxSize = 500 * 1024 // larger robots.txt is truncated
+)
+
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+// robotsRule is an Allow or Disallow line
+type robotsRule struct {
+	pattern string
+	re      *regexp.Regexp
+	allow   bool
+}
+
+// robotsGroup is the rules of user agents
+type robotsGroup struct {
+	agents     []string // in lower case
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// robots is the parsed robots.txt of a host
+type robots struct {
+	groups []*robotsGroup
+}
+
+// parseRobots parses robots.txt, lines not recognized are ignored
+func parseRobots(data []byte) *robots {
+	r := &robots{}
+	var group *robotsGroup
+	inAgents := false // consecutive user-agent lines share the same group
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				group = &robotsGroup{}
+				r.groups = append(r.groups, group)
+			}
+			group.agents = append(group.agents, strings.ToLower(value))
+			inAgents = true
+		case "allow", "disallow":
+			inAgents = false
+			// empty disallow allows everything
+			if group == nil || value == "" {
+				continue
+			}
+			group.rules = append(group.rules, robotsRule{pattern: value, re: robotsPattern(value), allow: key == "allow"})
+		case "crawl-delay":
+			inAgents = false
+			if group == nil {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				group.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+	return r
+}
+
+// group returns the group of the user agent, the most specific
+// agent matched is used, "*" if none, nil if no group applies
+func (r *robots) group(userAgent string) *robotsGroup {
+	userAgent = strings.ToLower(userAgent)
+
+	var matched, wildcard *robotsGroup
+	length := 0
+	for _, g := range r.groups {
+		for _, agent := range g.agents {
+			if agent == "*" {
+				if wildcard == nil {
+					wildcard = g
+				}
+			} else if strings.Contains(userAgent, agent) && len(agent) > length {
+				matched, length = g, len(agent)
+			}
+		}
+	}
+	if matched != nil {
+		return matched
+	}
+	return wildcard
+}
+
+// allowed returns true if the user agent may fetch the path,
+// the longest rule matched wins and Allow wins a tie
+func (r *robots) allowed(userAgent, path string) bool {
+	g := r.group(userAgent)
+	if g == nil {
+		return true
+	}
+
+	allow, length := true, -1
+	for _, rule := range g.rules {
+		if !rule.re.MatchString(path) {
+			continue
+		}
+		if len(rule.pattern) > length || len(rule.pattern) == length && rule.allow {
+			allow, length = rule.allow, len(rule.pattern)
+		}
+	}
+	return allow
+}
+
+// crawlDelay returns Crawl-delay of the user agent, 0 if not provided
+func (r *robots) crawlDelay(userAgent string) time.Duration {
+	if g := r.group(userAgent); g != nil {
+		return g.crawlDelay
+	}
+	return 0
+}
+
+// robotsPattern compiles path pattern supports "*" and "$"
+func robotsPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	parts := strings.Split(strings.TrimSuffix(pattern, "$"), "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// robotsEntry is robots.txt of a host being fetched or fetched
+type robotsEntry struct {
+	done    chan struct{} // closed once fetched
+	robots  *robots
+	err     error
+	expires time.Time
+}
+
+// fetched returns true if fetching is done, fields
+// must not be accessed before that
+func (e *robotsEntry) fetched() bool {
+	select {
+	case <-e.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// robotsCache fetches robots.txt once per host,
+// requests to the same host wait for the first fetch
+type robotsCache struct {
+	mu      sync.Mutex
+	entries map[string]*robotsEntry
+}
+
+func newRobotsCache() *robotsCache {
+	return &robotsCache{entries: make(map[string]*robotsEntry)}
+}
+
+// get returns robots.txt of the host, it is fetched by fetch if not cached
+func (rc *robotsCache) get(ctx context.Context, host string, fetch func() (*robots, error)) (*robots, error) {
+	rc.mu.Lock()
+	e, ok := rc.entries[host]
+	if ok && e.fetched() && time.Now().After(e.expires) {
+		ok = false
+	}
+	if !ok {
+		e = &robotsEntry{done: make(chan struct{})}
+		rc.entries[host] = e
+		rc.mu.Unlock()
+
+		e.robots, e.err = fetch()
+		e.expires = time.Now().Add(robotsTTL)
+
+		// failure is not cached, fetch again next time
+		if e.err != nil {
+			rc.mu.Lock()
+			if rc.entries[host] == e {
+				delete(rc.entries, host)
+			}
+			rc.mu.Unlock()
+		}
+		close(e.done)
+		return e.robots, e.err
+	}
+	rc.mu.Unlock()
+
+	select {
+	case <-e.done:
+		return e.robots, e.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// checkRobots returns ErrDisallowed if robots.txt of the host disallows
+// the link, Crawl-delay found will be applied to the host limiter.
+// Nothing will be checked if robots.txt is ignored.
+func (c *crawler) checkRobots(ctx context.Context, link *url.URL, userAgent string) error {
+	if c.robots == nil {
+		return nil
+	}
+
+	r, err := c.robots.get(ctx, link.Host, func() (*robots, error) {
+		return c.fetchRobots(ctx, link, userAgent)
+	})
+	if err != nil {
+		return err
+	}
+
+	if delay := r.crawlDelay(userAgent); delay > 0 {
+		c.limiter.setDelay(link.Host, delay)
+	}
+	if !r.allowed(userAgent, link.RequestURI()) {
+		return fmt.Errorf("%s: %w", link, ErrDisallowed)
+	}
+	return nil
+}
+
+// fetchRobots fetches robots.txt of the host, everything is allowed
+// if it is not found, *FetchError will be returned if failed
+func (c *crawler) fetchRobots(ctx context.Context, link *url.URL, userAgent string) (*robots, error) {
+	robotsURL := (&url.URL{Scheme: link.Scheme, Host: link.Host, Path: "/robots.txt"}).String()
+	if err := c.limiter.wait(ctx, link.Host); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.settings.RequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL, nil)
+	if err != nil {
+		return nil, &FetchError{URL: robotsURL, Err: err}
+	}
+	req.Header.Set("user-agent", userAgent)
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, &FetchError{URL: robotsURL, Err: err}
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		data, err := io.ReadAll(io.LimitReader(res.Body, robotsMaxSize))
+		if err != nil {
+			return nil, &FetchError{URL: robotsURL, Err: err}
+		}
+		return parseRobots(data), nil
+	case res.StatusCode >= 400 && res.StatusCode < 500 && res.StatusCode != http.StatusTooManyRequests:
+		// no robots.txt
+		return &robots{}, nil
+	default:
+		return nil, &FetchError{
+			URL:        robotsURL,
+			StatusCode: res.StatusCode,
+			RetryAfter: parseRetryAfter(res.Header.Get("Retry-After")),
+		}
+	}
+}
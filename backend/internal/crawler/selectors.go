@@ -0,0 +1,190 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/andybalholm/cascadia"
+)
+
+// SELECTOR_VERSION is the version of selector file supported
+const SELECTOR_VERSION = 1
+
+var ErrNotConfigurable = errors.New("site does not support selectors")
+
+// SelectorFile is the content of selector file, i.e. selectors.yaml
+type SelectorFile struct {
+	Version int
+	Sites   map[string]*Selectors
+}
+
+// Selectors are css selectors and attribute names used to parse product page
+type Selectors struct {
+	NotFoundTitle string `mapstructure:"not_found_title"` // title shown if product removed
+	NotFoundText  string `mapstructure:"not_found_text"`  // text of the title
+	ProductName   string `mapstructure:"product_name"`
+
+	StructuredData string `mapstructure:"structured_data"` // json-ld scripts, tried before attributes if provided
+
+	// pages served instead of the product page, optional
+	Maintenance []PageMarker `mapstructure:"maintenance"`
+	Captcha     []PageMarker `mapstructure:"captcha"`
+	BotBlock    []PageMarker `mapstructure:"bot_block"`
+
+	// product details, optional
+	Brand       string `mapstructure:"brand"`
+	Description string `mapstructure:"description"` // <br> is kept as new line
+	SpecTable   string `mapstructure:"spec_table"`  // <table>, name in th and value in td
+	Breadcrumb  string `mapstructure:"breadcrumb"`  // <a> of each category, from top level
+
+	Points    string `mapstructure:"points"`
+	StyleArea string `mapstructure:"style_area"` // styles are under the parent of it
+	Style     string `mapstructure:"style"`      // element holds attributes of a style
+
+	Attributes StyleAttributes `mapstructure:"attributes"`
+
+	ColourOptions     []string `mapstructure:"colour_options"` // inputs of colour, tried in order
+	ColourOptionName  string   `mapstructure:"colour_option_name"`
+	ColourOptionImage string   `mapstructure:"colour_option_image"`
+	ImageFallback     string   `mapstructure:"image_fallback"` // {productCode} will be replaced
+
+	Listing ListingSelectors `mapstructure:"listing"` // category and search result, optional
+}
+
+// ListingSelectors are css selectors of category and search result pages
+type ListingSelectors struct {
+	Item     string `mapstructure:"item"`      // element of each product
+	Link     string `mapstructure:"link"`      // <a> to product page under item
+	Name     string `mapstructure:"name"`      // under item
+	Price    string `mapstructure:"price"`     // under item
+	Image    string `mapstructure:"image"`     // <img> under item, data-src or src used
+	NextPage string `mapstructure:"next_page"` // shown if there are more pages
+}
+
+// StyleAttributes are attribute names of Selectors.Style
+type StyleAttributes struct {
+	Colour     string `mapstructure:"colour"`
+	Size       string `mapstructure:"size"`
+	SizeDetail string `mapstructure:"size_detail"`
+	Sku        string `mapstructure:"sku"`
+	VariantID  string `mapstructure:"variant_id"` // variant id in url of product page, i.e. ?s=
+	Price      string `mapstructure:"price"`
+	ListPrice  string `mapstructure:"list_price"`
+	Sale       string `mapstructure:"sale"`
+	Outlet     string `mapstructure:"outlet"`
+	Stock      string `mapstructure:"stock"`
+}
+
+// SelectorConfigurable is implemented by site adapters accept Selectors
+type SelectorConfigurable interface {
+	Selectors() *Selectors
+	SetSelectors(selectors *Selectors)
+}
+
+// Validate checks are all css selectors valid and required items provided
+func (s *Selectors) Validate() error {
+	selectors := map[string]string{
+		"not_found_title": s.NotFoundTitle,
+		"product_name":    s.ProductName,
+		"style_area":      s.StyleArea,
+		"style":           s.Style,
+	}
+	for i, selector := range s.ColourOptions {
+		selectors[fmt.Sprintf("colour_options[%d]", i)] = selector
+	}
+	if s.Points != "" {
+		selectors["points"] = s.Points
+	}
+	for name, markers := range map[string][]PageMarker{
+		"maintenance": s.Maintenance, "captcha": s.Captcha, "bot_block": s.BotBlock,
+	} {
+		for i, marker := range markers {
+			selectors[fmt.Sprintf("%s[%d].selector", name, i)] = marker.Selector
+		}
+	}
+	for name, selector := range map[string]string{
+		"structured_data": s.StructuredData,
+		"brand":           s.Brand,
+		"description":     s.Description,
+		"spec_table":      s.SpecTable,
+		"breadcrumb":      s.Breadcrumb,
+	} {
+		if selector != "" {
+			selectors[name] = selector
+		}
+	}
+
+	// listing is optional, link required if provided
+	if l := s.Listing; l.Item != "" {
+		selectors["listing.item"] = l.Item
+		selectors["listing.link"] = l.Link
+		for name, selector := range map[string]string{
+			"listing.name": l.Name, "listing.price": l.Price, "listing.image": l.Image, "listing.next_page": l.NextPage,
+		} {
+			if selector != "" {
+				selectors[name] = selector
+			}
+		}
+	}
+
+	for name, selector := range selectors {
+		if selector == "" {
+			return fmt.Errorf("%s: selector required", name)
+		}
+		if _, err := cascadia.ParseGroup(selector); err != nil {
+			return fmt.Errorf("%s: invalid selector %q: %v", name, selector, err)
+		}
+	}
+
+	required := map[string]string{
+		"not_found_text":   s.NotFoundText,
+		"attributes.sku":   s.Attributes.Sku,
+		"attributes.price": s.Attributes.Price,
+		"attributes.stock": s.Attributes.Stock,
+	}
+	for name, value := range required {
+		if value == "" {
+			return fmt.Errorf("%s: required", name)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks version and selectors of all sites
+func (f *SelectorFile) Validate() error {
+	if f.Version != SELECTOR_VERSION {
+		return fmt.Errorf("selector file version %d not supported, wanted %d", f.Version, SELECTOR_VERSION)
+	}
+
+	for site, selectors := range f.Sites {
+		adapter, ok := GetSiteAdapter(site)
+		if !ok {
+			return fmt.Errorf("%s: %w", site, ErrUnknownSite)
+		}
+		if _, ok := adapter.(SelectorConfigurable); !ok {
+			return fmt.Errorf("%s: %w", site, ErrNotConfigurable)
+		}
+		if selectors == nil {
+			return fmt.Errorf("%s: no selectors provided", site)
+		}
+		if err := selectors.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", site, err)
+		}
+	}
+	return nil
+}
+
+// ApplySelectors validates the selector file and applies it to the site adapters,
+// nothing will be changed if it is invalid
+func ApplySelectors(f *SelectorFile) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+
+	for site, selectors := range f.Sites {
+		adapter, _ := GetSiteAdapter(site)
+		adapter.(SelectorConfigurable).SetSelectors(selectors)
+	}
+	return nil
+}
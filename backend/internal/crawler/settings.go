@@ -0,0 +1,145 @@
+package crawler
+
+import "time"
+
+const (
+	defaultConcurrency     = 4
+	defaultRateLimit       = 1
+	defaultRateBurst       = 2
+	defaultMaxParsers      = 4
+	defaultRequestTimeout  = 60 * time.Second
+	defaultMaxRetries      = 3
+	defaultRetryBaseDelay  = time.Second
+	defaultRetryMaxDelay   = 30 * time.Second
+	defaultProxyFailures   = 3
+	defaultProxyCooldown   = 10 * time.Minute
+	defaultBreakerFailures = 5
+	defaultBreakerCooldown = 5 * time.Minute
+	defaultMaxResponseSize = 20 << 20
+)
+
+// Settings configures how the crawler fetches and parses pages.
+// Zero values will be replaced by defaults.
+type Settings struct {
+	Concurrency int     // number of pages fetched at the same time
+	RateLimit   float64 // requests per second per host, no limit if negative
+	RateBurst   int     // requests allowed in a burst per host
+	MaxParsers  int     // number of pages parsed at the same time
+
+	RequestTimeout  time.Duration // deadline of each http request
+	MaxResponseSize int64         // bytes of response read, larger responses are rejected
+
+	MaxRetries     int           // retries of transient errors, no retry if negative
+	RetryBaseDelay time.Duration // delay before the first retry
+	RetryMaxDelay  time.Duration // upper bound of delay between retries
+
+	IgnoreRobots bool // robots.txt and its Crawl-delay are respected unless true
+
+	ArchiveDir string // directory pages fetched are archived, not archived if empty
+
+	CassetteMode string // CASSETTE_RECORD, CASSETTE_REPLAY or empty to disable
+	CassetteDir  string // directory responses recorded
+
+	UserAgents []string // rotated in turn, USER_AGENT if empty
+
+	// proxies of the default http client, i.e. http://user:pw@host:port,
+	// socks5://host:port, requests are sent directly if empty
+	Proxies          []string
+	ProxyStrategy    string        // PROXY_ROUND_ROBIN or PROXY_LEAST_ERRORS
+	ProxyMaxFailures int           // consecutive failures before taken out of rotation
+	ProxyCooldown    time.Duration // time taken out of rotation
+
+	// requests to a host fail fast with *CircuitOpenError for BreakerCooldown
+	// after a blocked page, i.e. maintenance, or BreakerThreshold transient
+	// failures in a row, circuit breaker is disabled if threshold negative.
+	// Blocked pages served with 200 are found by parsers, requests
+	// in flight meanwhile are still sent.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// DefaultSettings returns settings used by NewCrawler
+func DefaultSettings() *Settings {
+	return &Settings{
+		Concurrency: defaultConcurrency,
+		RateLimit:   defaultRateLimit,
+		RateBurst:   defaultRateBurst,
+		MaxParsers:  defaultMaxParsers,
+
+		RequestTimeout:  defaultRequestTimeout,
+		MaxResponseSize: defaultMaxResponseSize,
+
+		MaxRetries:     defaultMaxRetries,
+		RetryBaseDelay: defaultRetryBaseDelay,
+		RetryMaxDelay:  defaultRetryMaxDelay,
+
+		UserAgents: []string{USER_AGENT},
+
+		ProxyStrategy:    PROXY_ROUND_ROBIN,
+		ProxyMaxFailures: defaultProxyFailures,
+		ProxyCooldown:    defaultProxyCooldown,
+
+		BreakerThreshold: defaultBreakerFailures,
+		BreakerCooldown:  defaultBreakerCooldown,
+	}
+}
+
+// withDefaults returns copy of settings with zero values set to default
+func (s *Settings) withDefaults() Settings {
+	settings := *DefaultSettings()
+	if s == nil {
+		return settings
+	}
+
+	if s.Concurrency > 0 {
+		settings.Concurrency = s.Concurrency
+	}
+	if s.RateLimit != 0 {
+		settings.RateLimit = s.RateLimit
+	}
+	if s.RateBurst > 0 {
+		settings.RateBurst = s.RateBurst
+	}
+	if s.MaxParsers > 0 {
+		settings.MaxParsers = s.MaxParsers
+	}
+	if s.RequestTimeout > 0 {
+		settings.RequestTimeout = s.RequestTimeout
+	}
+	if s.MaxResponseSize > 0 {
+		settings.MaxResponseSize = s.MaxResponseSize
+	}
+	if s.MaxRetries != 0 {
+		settings.MaxRetries = s.MaxRetries
+	}
+	if s.RetryBaseDelay > 0 {
+		settings.RetryBaseDelay = s.RetryBaseDelay
+	}
+	if s.RetryMaxDelay > 0 {
+		settings.RetryMaxDelay = s.RetryMaxDelay
+	}
+	if len(s.UserAgents) > 0 {
+		settings.UserAgents = s.UserAgents
+	}
+	if s.ProxyStrategy != "" {
+		settings.ProxyStrategy = s.ProxyStrategy
+	}
+	if s.ProxyMaxFailures > 0 {
+		settings.ProxyMaxFailures = s.ProxyMaxFailures
+	}
+	if s.ProxyCooldown > 0 {
+		settings.ProxyCooldown = s.ProxyCooldown
+	}
+	if s.BreakerThreshold != 0 {
+		settings.BreakerThreshold = s.BreakerThreshold
+	}
+	if s.BreakerCooldown > 0 {
+		settings.BreakerCooldown = s.BreakerCooldown
+	}
+	settings.Proxies = s.Proxies
+	settings.IgnoreRobots = s.IgnoreRobots
+	settings.ArchiveDir = s.ArchiveDir
+	settings.CassetteMode = s.CassetteMode
+	settings.CassetteDir = s.CassetteDir
+	return settings
+}
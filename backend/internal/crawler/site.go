@@ -0,0 +1,76 @@
+package crawler
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+const (
+	BELLE_MAISON = "bellemaison"
+
+	// DEFAULT_SITE is used when a product code carries no site
+	DEFAULT_SITE = BELLE_MAISON
+
+	siteSeparator = ":"
+)
+
+var ErrUnknownSite = errors.New("unknown source site")
+
+// SiteAdapter adapts the crawler to a specific online shop
+type SiteAdapter interface {
+	// Name returns the unique name of the site, i.e. bellemaison
+	Name() string
+	// ProductURL returns the url of product page
+	ProductURL(productCode string) string
+	// ValidateProductCode checks is the product code valid for the site
+	ValidateProductCode(productCode string) bool
+	// ParseHTML converts product page to Product struct
+	ParseHTML(html []byte) (*Product, error)
+}
+
+var siteAdapters = make(map[string]SiteAdapter)
+
+func init() {
+	RegisterSiteAdapter(newBellemaison())
+}
+
+// RegisterSiteAdapter adds adapter to the registry,
+// adapter with the same name will be replaced
+func RegisterSiteAdapter(adapter SiteAdapter) {
+	siteAdapters[adapter.Name()] = adapter
+}
+
+// GetSiteAdapter returns adapter registered under the site name
+func GetSiteAdapter(site string) (SiteAdapter, bool) {
+	adapter, ok := siteAdapters[site]
+	return adapter, ok
+}
+
+// Sites returns names of all registered sites
+func Sites() []string {
+	sites := make([]string, 0, len(siteAdapters))
+	for site := range siteAdapters {
+		sites = append(sites, site)
+	}
+	sort.Strings(sites)
+	return sites
+}
+
+// JoinCode returns product code qualified by site, i.e. "site:1234567".
+// Product code of DEFAULT_SITE is returned as it is.
+func JoinCode(site, productCode string) string {
+	if site == "" || site == DEFAULT_SITE {
+		return productCode
+	}
+	return site + siteSeparator + productCode
+}
+
+// SplitCode splits qualified product code into site and product code,
+// DEFAULT_SITE will be returned if no site provided
+func SplitCode(code string) (site, productCode string) {
+	if idx := strings.Index(code, siteSeparator); idx >= 0 {
+		return code[:idx], code[idx+len(siteSeparator):]
+	}
+	return DEFAULT_SITE, code
+}
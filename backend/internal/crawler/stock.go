@@ -0,0 +1,56 @@
+package crawler
+
+import (
+	"fmt"
+	"time"
+)
+
+// StockState is the availability of a style
+type StockState string
+
+const (
+	UnknownStock StockState = "unknown"
+	InStock      StockState = "in_stock"     // available, quantity not shown
+	LowStock     StockState = "low_stock"    // available, only Quantity left
+	SoldOut      StockState = "sold_out"     // may be restocked
+	Discontinued StockState = "discontinued" // will not be restocked
+	Backorder    StockState = "backorder"    // restock expected on ExpectedDate
+)
+
+// StockStatus describes the stock of a style
+type StockStatus struct {
+	State        StockState
+	Quantity     uint       // items left, LowStock only
+	ExpectedDate *time.Time // expected restock date of Backorder, nil if unknown
+}
+
+// Available returns true if the style can be ordered now
+func (s StockStatus) Available() bool {
+	return s.State == InStock || s.State == LowStock
+}
+
+// known returns true if the state is found
+func (s StockStatus) known() bool {
+	return s.State != "" && s.State != UnknownStock
+}
+
+// String returns description of the stock, i.e. "3 left", "back in stock on 11/20"
+func (s StockStatus) String() string {
+	switch s.State {
+	case InStock:
+		return "in stock"
+	case LowStock:
+		return fmt.Sprintf("%d left", s.Quantity)
+	case SoldOut:
+		return "sold out"
+	case Discontinued:
+		return "discontinued"
+	case Backorder:
+		if s.ExpectedDate != nil {
+			return fmt.Sprintf("back in stock on %d/%d", s.ExpectedDate.Month(), s.ExpectedDate.Day())
+		}
+		return "back in stock soon"
+	default:
+		return "unknown"
+	}
+}
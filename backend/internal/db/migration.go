@@ -0,0 +1,54 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// one-off data migrations, applied once and recorded in migrations table
+const (
+	MIGRATION_COMPRESS_PRICE_HISTORY = "compress_price_history"
+)
+
+// migrationLockTimeout is seconds waiting for the migration run by another
+// process, i.e. web and scheduler started at the same time
+const migrationLockTimeout = 600
+
+// Migration is a one-off data migration applied
+type Migration struct {
+	Name      string `gorm:"primaryKey;size:191"`
+	AppliedAt time.Time
+}
+
+// runOnce runs the migration unless applied already, other processes
+// wait for it to finish. The migration is recorded only if succeeded.
+func runOnce(dbClient *gorm.DB, name string, migrate func(*gorm.DB) error) error {
+	// the lock is held by the connection, it must be released by the same one
+	return dbClient.Connection(func(conn *gorm.DB) error {
+		lockName := "migration:" + name
+		locked := sql.NullInt64{}
+		if err := conn.Raw("SELECT GET_LOCK(?, ?)", lockName, migrationLockTimeout).Row().Scan(&locked); err != nil {
+			return err
+		}
+		if !locked.Valid || locked.Int64 != 1 {
+			return fmt.Errorf("migration %s: lock not acquired", name)
+		}
+		defer conn.Exec("SELECT RELEASE_LOCK(?)", lockName)
+
+		var applied int64
+		if err := conn.Model(&Migration{}).Where("name = ?", name).Count(&applied).Error; err != nil {
+			return err
+		}
+		if applied > 0 {
+			return nil
+		}
+
+		if err := migrate(conn); err != nil {
+			return err
+		}
+		return conn.Create(&Migration{Name: name, AppliedAt: time.Now()}).Error
+	})
+}
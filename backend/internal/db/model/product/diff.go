@@ -0,0 +1,105 @@
+package product
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/knchan0x/belle-maison/backend/internal/crawler"
+	"gorm.io/gorm"
+)
+
+// Change is a difference between the product stored and the one parsed
+type Change struct {
+	Style  string // colour-size, empty for the product itself
+	Field  string
+	Stored string // empty if the style is new
+	Parsed string // empty if the style is missing
+}
+
+// Diff compares the product parsed with the product and the latest
+// prices stored, it returns nothing if they are the same
+func (p *Product) Diff(dbClient *gorm.DB, parsed *crawler.Product) ([]Change, error) {
+	if parsed == nil {
+		return nil, EMPTY_PRODUCT
+	}
+
+	storedStyles, err := p.AllStyles(dbClient)
+	if err != nil {
+		return nil, err
+	}
+	prices, err := p.LatestPrices(dbClient)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []Change{}
+	compare := func(style, field string, stored, parsed interface{}) {
+		s, p := fmt.Sprint(stored), fmt.Sprint(parsed)
+		if s != p {
+			changes = append(changes, Change{Style: style, Field: field, Stored: s, Parsed: p})
+		}
+	}
+
+	compare("", "name", p.Name, parsed.Name)
+	compare("", "brand", p.Brand, parsed.Brand)
+	compare("", "category", p.CategoryID, leafCategory(parsed))
+
+	matched := map[uint]bool{}
+	for idx := range parsed.Styles {
+		style := &parsed.Styles[idx]
+		key := style.Colour + "-" + style.Size
+		dbStyle, ok := findStyle(storedStyles, style)
+		if !ok {
+			changes = append(changes, Change{Style: key, Field: "style", Parsed: "new"})
+			continue
+		}
+		matched[dbStyle.ID] = true
+
+		compare(key, "style_code", dbStyle.StyleCode, style.StyleCode)
+		compare(key, "image_url", dbStyle.ImageUrl, style.ImageUrl)
+
+		price, ok := prices[dbStyle.ID]
+		if !ok {
+			changes = append(changes, Change{Style: key, Field: "price", Parsed: fmt.Sprint(style.Price)})
+			continue
+		}
+		latest := newPrice(dbStyle.ID, style)
+		compare(key, "price", price.Price, latest.Price)
+		compare(key, "regular_price", price.RegularPrice, latest.RegularPrice)
+		compare(key, "sale_price", price.SalePrice, latest.SalePrice)
+		compare(key, "discount", price.Discount, latest.Discount)
+		compare(key, "points", price.Points, latest.Points)
+		compare(key, "stock", price.StockStatus(), style.Stock)
+	}
+
+	// styles stored but not found any more, i.e. parser drift
+	missing := []string{}
+	for key, dbStyle := range storedStyles {
+		if !matched[dbStyle.ID] {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	for _, key := range missing {
+		changes = append(changes, Change{Style: key, Field: "style", Stored: "exists"})
+	}
+
+	return changes, nil
+}
+
+// StockStatus returns stock status recorded
+func (p *Price) StockStatus() crawler.StockStatus {
+	return crawler.StockStatus{
+		State:        p.StockState,
+		Quantity:     p.Stock,
+		ExpectedDate: p.RestockDate,
+	}
+}
+
+// leafCategory returns id of the lowest level of breadcrumb
+func leafCategory(p *crawler.Product) string {
+	if len(p.Breadcrumb) == 0 {
+		return ""
+	}
+	return p.Breadcrumb[len(p.Breadcrumb)-1].ID
+}
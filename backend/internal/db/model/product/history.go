@@ -0,0 +1,331 @@
+package product
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/knchan0x/belle-maison/backend/internal/crawler"
+	"gorm.io/gorm"
+)
+
+// price history is stored as intervals, i.e. the price observed from
+// FirstSeen to LastSeen, a new interval starts only when anything changed
+// or the price was not seen for maxPriceGap, i.e. scraping stopped
+
+const (
+	// compressBatchSize is number of rows compressed at once by CompressPriceHistory
+	compressBatchSize = 1000
+	// maxPriceGap is the longest time between observations an interval lasts,
+	// products are scraped daily at midnight and retried hourly until the day
+	// ends if failed, i.e. seen again by the end of the next day
+	maxPriceGap = 48 * time.Hour
+)
+
+// sameAs returns true if prices and stock are the same, times are not compared
+func (p *Price) sameAs(other *Price) bool {
+	return p.Price == other.Price && p.RegularPrice == other.RegularPrice &&
+		p.SalePrice == other.SalePrice && p.Discount == other.Discount &&
+		p.Points == other.Points && p.StockState == other.StockState &&
+		p.Stock == other.Stock && sameDate(p.RestockDate, other.RestockDate)
+}
+
+// planRecord returns id of intervals extended to the time and intervals
+// created for prices observed at the time. The latest interval of the style is
+// extended if the same and seen within maxPriceGap, new interval started if not.
+// latest is the latest price of each style, key = style id.
+func planRecord(latest map[uint]Price, prices []Price, at time.Time) (extended []uint, created []Price) {
+	for _, price := range prices {
+		if last, ok := latest[price.StyleID]; ok && last.sameAs(&price) && !at.After(last.LastSeen.Add(maxPriceGap)) {
+			extended = append(extended, last.ID)
+			continue
+		}
+		price.Model = gorm.Model{}
+		price.FirstSeen, price.LastSeen = at, at
+		created = append(created, price)
+	}
+	return extended, created
+}
+
+// recordPrices records prices observed at the time, see planRecord
+func recordPrices(dbClient *gorm.DB, latest map[uint]Price, prices []Price, at time.Time) error {
+	extended, created := planRecord(latest, prices, at)
+	return dbClient.Transaction(func(tx *gorm.DB) error {
+		if len(extended) > 0 {
+			if err := tx.Model(&Price{}).Where("id IN ?", extended).Update("last_seen", at).Error; err != nil {
+				return err
+			}
+		}
+		if len(created) > 0 {
+			return tx.Create(&created).Error
+		}
+		return nil
+	})
+}
+
+// extendPrices records prices recorded in the last update again at the time,
+// i.e. the product is the same as last time it was fetched
+func (p *Product) extendPrices(dbClient *gorm.DB, at time.Time) error {
+	latest, err := p.LatestPrices(dbClient)
+	if err != nil || len(latest) == 0 {
+		return err
+	}
+	return recordPrices(dbClient, latest, lastUpdated(latest), at)
+}
+
+// lastUpdated returns prices recorded in the last update,
+// styles removed from the site earlier are not included
+func lastUpdated(latest map[uint]Price) []Price {
+	lastUpdate := time.Time{}
+	for _, price := range latest {
+		if price.LastSeen.After(lastUpdate) {
+			lastUpdate = price.LastSeen
+		}
+	}
+
+	prices := []Price{}
+	for _, price := range latest {
+		if !price.LastSeen.Before(lastUpdate.Add(-updateWindow)) {
+			prices = append(prices, price)
+		}
+	}
+	return prices
+}
+
+// replayPlan is the changes to replay a price into the interval stored
+type replayPlan struct {
+	inPlace bool    // prices of the interval stored are replaced
+	stored  Price   // interval stored after replay
+	created []Price // intervals created
+}
+
+// planReplay plans to rewrite the interval stored, recorded within window from
+// the time, with the price observed at the time. The interval is split if it
+// lasted before or after the window.
+func planReplay(stored, replayed Price, at time.Time, window time.Duration) replayPlan {
+	from, to := at.Add(-window), at.Add(window)
+
+	// observed at the time only
+	if !stored.FirstSeen.Before(from) && !stored.LastSeen.After(to) {
+		updated := replayed
+		updated.Model, updated.StyleID = stored.Model, stored.StyleID
+		updated.FirstSeen, updated.LastSeen = stored.FirstSeen, stored.LastSeen
+		return replayPlan{inPlace: true, stored: updated}
+	}
+
+	replayed.FirstSeen, replayed.LastSeen = at, at
+	replayed.CreatedAt, replayed.UpdatedAt = at, at
+	plan := replayPlan{stored: stored, created: []Price{replayed}}
+
+	switch {
+	case !stored.FirstSeen.Before(from):
+		// started at the time
+		plan.stored.FirstSeen = at.Add(time.Second)
+	case !stored.LastSeen.After(to):
+		// ended at the time
+		plan.stored.LastSeen = at.Add(-time.Second)
+	default:
+		// lasted before and after the time
+		after := stored
+		after.ID = 0
+		after.FirstSeen = at.Add(time.Second)
+		plan.created = append(plan.created, after)
+		plan.stored.LastSeen = at.Add(-time.Second)
+	}
+	return plan
+}
+
+// replayPrice rewrites the interval stored with the price observed at the time,
+// see planReplay. It returns true if the interval is updated in place, false if
+// new interval created.
+func replayPrice(tx *gorm.DB, stored *Price, replayed Price, at time.Time, window time.Duration) (bool, error) {
+	plan := planReplay(*stored, replayed, at, window)
+	if plan.inPlace {
+		return true, tx.Model(stored).UpdateColumns(map[string]interface{}{
+			"price":         plan.stored.Price,
+			"regular_price": plan.stored.RegularPrice,
+			"sale_price":    plan.stored.SalePrice,
+			"discount":      plan.stored.Discount,
+			"points":        plan.stored.Points,
+			"stock_state":   plan.stored.StockState,
+			"stock":         plan.stored.Stock,
+			"restock_date":  plan.stored.RestockDate,
+		}).Error
+	}
+
+	if err := tx.Create(&plan.created).Error; err != nil {
+		return false, err
+	}
+	return false, tx.Model(stored).UpdateColumns(map[string]interface{}{
+		"first_seen": plan.stored.FirstSeen,
+		"last_seen":  plan.stored.LastSeen,
+	}).Error
+}
+
+// CompressPriceHistory converts price history recorded one row per update,
+// before intervals were introduced, into intervals. Consecutive rows of the
+// same style having the same prices and stock are merged into the first one.
+// It is a one-off migration, rows converted are not converted again.
+func CompressPriceHistory(dbClient *gorm.DB) error {
+	styleIDs := []uint{}
+	if err := dbClient.Model(&Price{}).
+		Where("first_seen IS NULL").
+		Distinct().Pluck("style_id", &styleIDs).Error; err != nil {
+		return err
+	}
+
+	for _, styleID := range styleIDs {
+		if err := compressStyleHistory(dbClient, styleID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compressStyleHistory compresses price history of the style not converted yet,
+// compressBatchSize rows at a time
+func compressStyleHistory(dbClient *gorm.DB, styleID uint) error {
+	var open []Price // the last interval, rows of next batch may be merged into
+	for {
+		prices := []Price{}
+		if err := dbClient.Where("style_id = ? AND first_seen IS NULL", styleID).
+			Order("created_at, id").Limit(compressBatchSize).Find(&prices).Error; err != nil {
+			return err
+		}
+		if len(prices) == 0 {
+			return nil
+		}
+
+		intervals, merged := compressIntervals(append(open, prices...))
+		err := dbClient.Transaction(func(tx *gorm.DB) error {
+			for _, interval := range intervals {
+				if err := tx.Model(&interval).UpdateColumns(map[string]interface{}{
+					"first_seen": interval.FirstSeen,
+					"last_seen":  interval.LastSeen,
+				}).Error; err != nil {
+					return err
+				}
+			}
+			if len(merged) > 0 {
+				return tx.Unscoped().Delete(&Price{}, merged).Error
+			}
+			return nil
+		})
+		if err != nil || len(prices) < compressBatchSize {
+			return err
+		}
+		open = []Price{intervals[len(intervals)-1]}
+	}
+}
+
+// compressIntervals merges consecutive rows of the same prices and stock seen
+// within maxPriceGap into the first one, the way planRecord extends intervals,
+// it returns intervals and id of rows merged. Rows recorded one
+// per update are seen at CreatedAt, intervals converted already are kept.
+func compressIntervals(prices []Price) (intervals []Price, merged []uint) {
+	for _, price := range prices {
+		if price.FirstSeen.IsZero() {
+			price.FirstSeen, price.LastSeen = price.CreatedAt, price.CreatedAt
+		}
+		if n := len(intervals); n > 0 && intervals[n-1].sameAs(&price) && !price.FirstSeen.After(intervals[n-1].LastSeen.Add(maxPriceGap)) {
+			intervals[n-1].LastSeen = price.LastSeen
+			merged = append(merged, price.ID)
+			continue
+		}
+		intervals = append(intervals, price)
+	}
+	return intervals, merged
+}
+
+const (
+	INTERVAL_DAILY  = "daily"
+	INTERVAL_WEEKLY = "weekly"
+)
+
+// MAX_PERIODS is the most periods downsampled at once, i.e. daily for 2 years
+const MAX_PERIODS = 1000
+
+var (
+	UNKNOWN_INTERVAL = errors.New("unknown interval")
+	TOO_MANY_PERIODS = errors.New("too many periods")
+)
+
+// PricePoint is the lowest, highest and last price observed in a period
+type PricePoint struct {
+	Time       time.Time // start of the period
+	Min        uint
+	Max        uint
+	Close      uint               // last price of the period
+	StockState crawler.StockState // stock of the last price
+}
+
+// Downsample returns a point of each period, i.e. INTERVAL_DAILY, from the time
+// to the time, days start at midnight in location of from and weeks on Monday.
+// Prices must be sorted by FirstSeen. Discontinued prices, and prices of 0
+// recorded for them before, are ignored and periods nothing observed are skipped. At most MAX_PERIODS periods.
+func Downsample(prices []Price, from, to time.Time, interval string) ([]PricePoint, error) {
+	days := 0
+	switch interval {
+	case INTERVAL_DAILY:
+		days = 1
+	case INTERVAL_WEEKLY:
+		days = 7
+	default:
+		return nil, UNKNOWN_INTERVAL
+	}
+
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+	if interval == INTERVAL_WEEKLY {
+		start = start.AddDate(0, 0, -(int(start.Weekday())+6)%7)
+	}
+	periods := []time.Time{}
+	for t := start; !t.After(to); t = t.AddDate(0, 0, days) {
+		if len(periods) == MAX_PERIODS {
+			return nil, TOO_MANY_PERIODS
+		}
+		periods = append(periods, t)
+	}
+
+	// index of the period the time in
+	periodOf := func(t time.Time) int {
+		return sort.Search(len(periods), func(i int) bool { return periods[i].After(t) }) - 1
+	}
+
+	points := make([]*PricePoint, len(periods))
+	for idx := range prices {
+		price := &prices[idx]
+		if price.Price == 0 || price.StockState == crawler.Discontinued || price.LastSeen.Before(from) || price.FirstSeen.After(to) {
+			continue
+		}
+
+		first, last := periodOf(price.FirstSeen), periodOf(price.LastSeen)
+		if first < 0 {
+			first = 0
+		}
+		if last < 0 || last >= len(periods) {
+			last = len(periods) - 1
+		}
+		for i := first; i <= last; i++ {
+			point := points[i]
+			if point == nil {
+				point = &PricePoint{Time: periods[i], Min: price.Price, Max: price.Price}
+				points[i] = point
+			}
+			if price.Price < point.Min {
+				point.Min = price.Price
+			}
+			if price.Price > point.Max {
+				point.Max = price.Price
+			}
+			point.Close, point.StockState = price.Price, price.StockState
+		}
+	}
+
+	result := []PricePoint{}
+	for _, point := range points {
+		if point != nil {
+			result = append(result, *point)
+		}
+	}
+	return result, nil
+}
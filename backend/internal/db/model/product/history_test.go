@@ -0,0 +1,285 @@
+package product
+
+import (
+	"testing"
+	"time"
+
+	"github.com/knchan0x/belle-maison/backend/internal/crawler"
+	"gorm.io/gorm"
+)
+
+var baseTime = time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// price returns price of the style seen from first to last hours after baseTime
+func price(id, styleID, value uint, first, last int) Price {
+	return Price{
+		Model:     gorm.Model{ID: id, CreatedAt: baseTime.Add(time.Duration(first) * time.Hour)},
+		StyleID:   styleID,
+		Price:     value,
+		FirstSeen: baseTime.Add(time.Duration(first) * time.Hour),
+		LastSeen:  baseTime.Add(time.Duration(last) * time.Hour),
+	}
+}
+
+func TestPlanRecord(t *testing.T) {
+	at := baseTime.Add(10 * time.Hour)
+	latest := map[uint]Price{
+		1: price(11, 1, 1000, 0, 9),
+		2: price(12, 2, 1000, 0, 9),
+		3: price(13, 3, 1000, -96, -40), // not seen for 2 days, a day missed
+		5: price(15, 5, 1000, -48, -14), // scraped daily
+		6: price(16, 6, 1000, -48, -37), // retried until late the next day
+	}
+	prices := []Price{
+		{StyleID: 1, Price: 1000},
+		{StyleID: 2, Price: 900},
+		{StyleID: 3, Price: 1000},
+		{StyleID: 4, Price: 1000}, // new style
+		{StyleID: 5, Price: 1000},
+		{StyleID: 6, Price: 1000},
+	}
+
+	extended, created := planRecord(latest, prices, at)
+	if len(extended) != 3 || extended[0] != 11 || extended[1] != 15 || extended[2] != 16 {
+		t.Errorf("expected intervals 11, 15 and 16 extended, got %v", extended)
+	}
+	if len(created) != 3 {
+		t.Fatalf("expected 3 intervals created, got %d", len(created))
+	}
+	for i, styleID := range []uint{2, 3, 4} {
+		c := created[i]
+		if c.StyleID != styleID || c.ID != 0 || !c.FirstSeen.Equal(at) || !c.LastSeen.Equal(at) {
+			t.Errorf("unexpected interval created for style %d: %+v", styleID, c)
+		}
+	}
+}
+
+func TestLastUpdated(t *testing.T) {
+	latest := map[uint]Price{
+		1: price(11, 1, 1000, 0, 9),
+		2: price(12, 2, 1000, 0, 9),
+		3: price(13, 3, 1000, 0, 5), // removed from the site
+	}
+	at := baseTime.Add(10 * time.Hour)
+
+	extended, created := planRecord(latest, lastUpdated(latest), at)
+	if len(extended) != 2 || len(created) != 0 {
+		t.Errorf("expected 2 intervals extended, got %v, created %d", extended, len(created))
+	}
+
+	// scraped the next day
+	at = baseTime.Add(33 * time.Hour)
+	if extended, created = planRecord(latest, lastUpdated(latest), at); len(extended) != 2 || len(created) != 0 {
+		t.Errorf("expected 2 intervals extended the next day, got %v, created %d", extended, len(created))
+	}
+
+	// scraping stopped, intervals started again
+	at = baseTime.Add(72 * time.Hour)
+	extended, created = planRecord(latest, lastUpdated(latest), at)
+	if len(extended) != 0 || len(created) != 2 {
+		t.Fatalf("expected 2 intervals created, got %d, extended %v", len(created), extended)
+	}
+	for _, c := range created {
+		if c.ID != 0 || c.Price != 1000 || !c.FirstSeen.Equal(at) {
+			t.Errorf("unexpected interval created: %+v", c)
+		}
+	}
+}
+
+func TestCompressIntervals(t *testing.T) {
+	// recorded one row per update
+	rows := []Price{
+		{Model: gorm.Model{ID: 1, CreatedAt: baseTime}, Price: 1000},
+		{Model: gorm.Model{ID: 2, CreatedAt: baseTime.Add(time.Hour)}, Price: 1000},
+		{Model: gorm.Model{ID: 3, CreatedAt: baseTime.Add(2 * time.Hour)}, Price: 900},
+		{Model: gorm.Model{ID: 4, CreatedAt: baseTime.Add(3 * time.Hour)}, Price: 1000},
+		{Model: gorm.Model{ID: 5, CreatedAt: baseTime.Add(4 * time.Hour)}, Price: 1000},
+	}
+
+	intervals, merged := compressIntervals(rows)
+	expected := []Price{price(1, 0, 1000, 0, 1), price(3, 0, 900, 2, 2), price(4, 0, 1000, 3, 4)}
+	if len(intervals) != len(expected) {
+		t.Fatalf("expected %d intervals, got %d", len(expected), len(intervals))
+	}
+	for i, e := range expected {
+		got := intervals[i]
+		if got.ID != e.ID || got.Price != e.Price || !got.FirstSeen.Equal(e.FirstSeen) || !got.LastSeen.Equal(e.LastSeen) {
+			t.Errorf("interval %d: expected %+v, got %+v", i, e, got)
+		}
+	}
+	if len(merged) != 2 || merged[0] != 2 || merged[1] != 5 {
+		t.Errorf("expected rows 2 and 5 merged, got %v", merged)
+	}
+
+	// interval of previous batch extended by rows of next batch
+	open := intervals[2]
+	intervals, merged = compressIntervals([]Price{open, {Model: gorm.Model{ID: 6, CreatedAt: baseTime.Add(5 * time.Hour)}, Price: 1000}})
+	if len(intervals) != 1 || !intervals[0].FirstSeen.Equal(open.FirstSeen) || !intervals[0].LastSeen.Equal(baseTime.Add(5*time.Hour)) {
+		t.Errorf("interval not extended: %+v", intervals)
+	}
+	if len(merged) != 1 || merged[0] != 6 {
+		t.Errorf("expected row 6 merged, got %v", merged)
+	}
+
+	// recorded daily, a day missed
+	rows = []Price{
+		{Model: gorm.Model{ID: 7, CreatedAt: baseTime}, Price: 1000},
+		{Model: gorm.Model{ID: 8, CreatedAt: baseTime.Add(24 * time.Hour)}, Price: 1000},
+		{Model: gorm.Model{ID: 9, CreatedAt: baseTime.Add(47 * time.Hour)}, Price: 1000}, // retried late
+		{Model: gorm.Model{ID: 10, CreatedAt: baseTime.Add(96 * time.Hour)}, Price: 1000},
+	}
+	intervals, merged = compressIntervals(rows)
+	if len(intervals) != 2 || intervals[0].ID != 7 || !intervals[0].LastSeen.Equal(baseTime.Add(47*time.Hour)) || intervals[1].ID != 10 {
+		t.Errorf("unexpected intervals of daily rows: %+v", intervals)
+	}
+	if len(merged) != 2 || merged[0] != 8 || merged[1] != 9 {
+		t.Errorf("expected rows 8 and 9 merged, got %v", merged)
+	}
+}
+
+func TestPlanReplay(t *testing.T) {
+	at := baseTime.Add(5 * time.Hour)
+	window := 10 * time.Minute
+	replayed := Price{StyleID: 1, Price: 900}
+
+	tests := []struct {
+		name      string
+		stored    Price
+		inPlace   bool
+		first     time.Time // of interval stored after replay
+		last      time.Time
+		created   int
+		afterFrom time.Time // first seen of interval split after the time
+	}{
+		{
+			name:    "observed at the time only",
+			stored:  price(1, 1, 1000, 5, 5),
+			inPlace: true,
+			first:   at,
+			last:    at,
+		},
+		{
+			name:    "started at the time",
+			stored:  price(1, 1, 1000, 5, 8),
+			first:   at.Add(time.Second),
+			last:    baseTime.Add(8 * time.Hour),
+			created: 1,
+		},
+		{
+			name:    "ended at the time",
+			stored:  price(1, 1, 1000, 2, 5),
+			first:   baseTime.Add(2 * time.Hour),
+			last:    at.Add(-time.Second),
+			created: 1,
+		},
+		{
+			name:      "lasted before and after the time",
+			stored:    price(1, 1, 1000, 2, 8),
+			first:     baseTime.Add(2 * time.Hour),
+			last:      at.Add(-time.Second),
+			created:   2,
+			afterFrom: at.Add(time.Second),
+		},
+	}
+
+	for _, test := range tests {
+		plan := planReplay(test.stored, replayed, at, window)
+		if plan.inPlace != test.inPlace || len(plan.created) != test.created {
+			t.Errorf("%s: unexpected plan: %+v", test.name, plan)
+			continue
+		}
+		if !plan.stored.FirstSeen.Equal(test.first) || !plan.stored.LastSeen.Equal(test.last) {
+			t.Errorf("%s: expected interval stored from %s to %s, got %s to %s",
+				test.name, test.first, test.last, plan.stored.FirstSeen, plan.stored.LastSeen)
+		}
+
+		if test.inPlace {
+			if plan.stored.ID != test.stored.ID || plan.stored.Price != replayed.Price {
+				t.Errorf("%s: interval not replaced: %+v", test.name, plan.stored)
+			}
+			continue
+		}
+		if plan.stored.Price != test.stored.Price {
+			t.Errorf("%s: price of interval stored changed: %+v", test.name, plan.stored)
+		}
+		if c := plan.created[0]; c.ID != 0 || c.Price != replayed.Price || !c.FirstSeen.Equal(at) || !c.LastSeen.Equal(at) {
+			t.Errorf("%s: unexpected interval replayed: %+v", test.name, c)
+		}
+		if test.created == 2 {
+			after := plan.created[1]
+			if after.ID != 0 || after.Price != test.stored.Price || !after.FirstSeen.Equal(test.afterFrom) || !after.LastSeen.Equal(test.stored.LastSeen) {
+				t.Errorf("%s: unexpected interval split: %+v", test.name, after)
+			}
+		}
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	at := func(day, hour int) time.Time {
+		return time.Date(2023, 3, day, hour, 0, 0, 0, time.UTC)
+	}
+	seen := func(value uint, first, last time.Time) Price {
+		return Price{Price: value, FirstSeen: first, LastSeen: last}
+	}
+	removed := seen(800, at(4, 10), at(4, 11))
+	removed.StockState = crawler.Discontinued
+	prices := []Price{
+		seen(500, at(-8, 0), at(1, 6)),   // since before from
+		seen(1000, at(1, 12), at(2, 12)), // across days
+		seen(800, at(2, 13), at(2, 20)),
+		seen(0, at(3, 10), at(3, 11)),   // recorded for removed products before, ignored
+		removed,                         // discontinued, ignored
+		seen(1200, at(5, 9), at(6, 9)),  // across weeks, Sunday to Monday
+		seen(1500, at(9, 0), at(10, 0)), // after to
+	}
+	from, to := at(1, 0), at(7, 0).Add(-time.Nanosecond)
+
+	tests := []struct {
+		interval string
+		expected []PricePoint
+	}{
+		{
+			interval: INTERVAL_DAILY,
+			expected: []PricePoint{
+				{Time: at(1, 0), Min: 500, Max: 1000, Close: 1000},
+				{Time: at(2, 0), Min: 800, Max: 1000, Close: 800},
+				{Time: at(5, 0), Min: 1200, Max: 1200, Close: 1200},
+				{Time: at(6, 0), Min: 1200, Max: 1200, Close: 1200},
+			},
+		},
+		{
+			interval: INTERVAL_WEEKLY,
+			expected: []PricePoint{
+				{Time: time.Date(2023, 2, 27, 0, 0, 0, 0, time.UTC), Min: 500, Max: 1200, Close: 1200},
+				{Time: at(6, 0), Min: 1200, Max: 1200, Close: 1200},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		points, err := Downsample(prices, from, to, test.interval)
+		if err != nil {
+			t.Errorf("%s: failed to downsample: %v", test.interval, err)
+			continue
+		}
+		if len(points) != len(test.expected) {
+			t.Errorf("%s: expected %d points, got %+v", test.interval, len(test.expected), points)
+			continue
+		}
+		for i, e := range test.expected {
+			if p := points[i]; !p.Time.Equal(e.Time) || p.Min != e.Min || p.Max != e.Max || p.Close != e.Close {
+				t.Errorf("%s: point %d: expected %+v, got %+v", test.interval, i, e, p)
+			}
+		}
+	}
+
+	if _, err := Downsample(prices, from, to, "hourly"); err != UNKNOWN_INTERVAL {
+		t.Errorf("expected UNKNOWN_INTERVAL, got %v", err)
+	}
+	if _, err := Downsample(prices, from.AddDate(-3, 0, 0), to, INTERVAL_DAILY); err != TOO_MANY_PERIODS {
+		t.Errorf("expected TOO_MANY_PERIODS, got %v", err)
+	}
+	if _, err := Downsample(prices, from.AddDate(-2, 0, 0), to, INTERVAL_DAILY); err != nil {
+		t.Errorf("2 years not downsampled: %v", err)
+	}
+}
@@ -1,7 +1,10 @@
 package product
 
 import (
+	"database/sql"
 	"errors"
+	"sort"
+	"time"
 
 	"github.com/knchan0x/belle-maison/backend/internal/crawler"
 	"gorm.io/gorm"
@@ -10,10 +13,35 @@ import (
 type Product struct {
 	gorm.Model
 	Name        string
+	SourceSite  string `gorm:"default:bellemaison"`
 	ProductCode string
+	Brand       string
+	Description string `gorm:"type:text"`
+	CategoryID  string `gorm:"index"` // lowest level of breadcrumb
+	Category    string
+	Categories  []Category // breadcrumb, from top level
+	Specs       []Spec
 	Styles      []Style
 }
 
+// Category is a level of breadcrumb of the product
+type Category struct {
+	gorm.Model
+	ProductID  uint   `gorm:"index"`
+	Level      uint   // 0 for top level
+	CategoryID string `gorm:"index"`
+	Name       string
+}
+
+// Spec is an item of spec sheet, i.e. size, material
+type Spec struct {
+	gorm.Model
+	ProductID uint `gorm:"index"`
+	Position  uint
+	Name      string
+	Value     string `gorm:"type:text"`
+}
+
 type Style struct {
 	gorm.Model
 	ProductID      uint
@@ -21,16 +49,215 @@ type Style struct {
 	Colour         string
 	Size           string
 	ImageUrl       string
+	ImageHash      string     // hash of local copy in image store, empty if not mirrored
+	ImageCheckedAt *time.Time // last attempt to mirror the image
 	PriceHistories []Price
+	Rejections     []RejectedObservation
 }
 
+// Price is the price and stock of the style observed from FirstSeen to LastSeen
 type Price struct {
 	gorm.Model
-	StyleID uint
-	Price   uint
-	Stock   uint
+	StyleID      uint      `gorm:"index"`
+	FirstSeen    time.Time `gorm:"index"`
+	LastSeen     time.Time `gorm:"index"` // extended while nothing changed
+	Price        uint
+	RegularPrice uint
+	SalePrice    uint
+	Discount     uint
+	Points       uint
+	StockState   crawler.StockState
+	Stock        uint       // items left, low stock only
+	RestockDate  *time.Time // expected restock date of backorder
+}
+
+// RejectedObservation is a price observed but not recorded as implausible,
+// the raw price is kept to find out what was parsed wrongly
+type RejectedObservation struct {
+	gorm.Model
+	StyleID    uint      `gorm:"index"`
+	ObservedAt time.Time `gorm:"index"`
+	Reason     string    // i.e. crawler.REJECT_ZERO_PRICE
+	Price      uint      // price parsed
+	RawPrice   string    // price shown on the page
+}
+
+// newRejection returns rejection of the style parsed at the time
+func newRejection(styleID uint, style *crawler.Style, at time.Time) RejectedObservation {
+	return RejectedObservation{
+		StyleID:    styleID,
+		ObservedAt: at,
+		Reason:     style.Rejected,
+		Price:      style.Price,
+		RawPrice:   style.RawPrice,
+	}
+}
+
+// newPrice returns price history of the style parsed
+func newPrice(styleID uint, style *crawler.Style) Price {
+	return Price{
+		StyleID:      styleID,
+		Price:        style.Price,
+		RegularPrice: style.RegularPrice,
+		SalePrice:    style.SalePrice,
+		Discount:     style.Discount,
+		Points:       style.Points,
+		StockState:   style.Stock.State,
+		Stock:        style.Stock.Quantity,
+		RestockDate:  style.Stock.ExpectedDate,
+	}
+}
+
+// discontinued returns prices of styles removed from the site, the last
+// price is kept for the history and the price jumps compared with it
+func discontinued(latest map[uint]Price) []Price {
+	prices := make([]Price, 0, len(latest))
+	for styleID, last := range latest {
+		prices = append(prices, Price{
+			StyleID:      styleID,
+			Price:        last.Price,
+			RegularPrice: last.RegularPrice,
+			SalePrice:    last.SalePrice,
+			Discount:     last.Discount,
+			Points:       last.Points,
+			StockState:   crawler.Discontinued,
+		})
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i].StyleID < prices[j].StyleID })
+	return prices
+}
+
+// TableName of Category, categories are shared by products on the site
+func (Category) TableName() string {
+	return "product_categories"
+}
+
+// TableName of Spec
+func (Spec) TableName() string {
+	return "product_specs"
+}
+
+// setDetails sets brand, description, categories and specs of the product parsed,
+// categories and specs are not saved
+func (p *Product) setDetails(product *crawler.Product) {
+	p.Brand = product.Brand
+	p.Description = product.Description
+
+	p.CategoryID, p.Category = "", ""
+	p.Categories = make([]Category, len(product.Breadcrumb))
+	for i, category := range product.Breadcrumb {
+		p.Categories[i] = Category{ProductID: p.ID, Level: uint(i), CategoryID: category.ID, Name: category.Name}
+		p.CategoryID, p.Category = category.ID, category.Name
+	}
+
+	p.Specs = make([]Spec, len(product.Specs))
+	for i, spec := range product.Specs {
+		p.Specs[i] = Spec{ProductID: p.ID, Position: uint(i), Name: spec.Name, Value: spec.Value}
+	}
+}
+
+// updateDetails replaces name, brand, description, categories and specs
+// stored with the product parsed, categories and specs are soft deleted
+// as Delete does and rewritten only if changed
+func (p *Product) updateDetails(dbClient *gorm.DB, product *crawler.Product) error {
+	stored := *p
+	p.Name = product.Name
+	p.setDetails(product)
+	productChanged := p.Name != stored.Name || p.Brand != stored.Brand || p.Description != stored.Description ||
+		p.CategoryID != stored.CategoryID || p.Category != stored.Category
+
+	categories := []Category{}
+	if err := dbClient.Where("product_id = ?", p.ID).Order("level").Find(&categories).Error; err != nil {
+		return err
+	}
+	specs := []Spec{}
+	if err := dbClient.Where("product_id = ?", p.ID).Order("position").Find(&specs).Error; err != nil {
+		return err
+	}
+	categoriesChanged := !sameCategories(categories, p.Categories)
+	specsChanged := !sameSpecs(specs, p.Specs)
+
+	if !productChanged && !categoriesChanged && !specsChanged {
+		return nil
+	}
+
+	return dbClient.Transaction(func(tx *gorm.DB) error {
+		if productChanged {
+			if err := tx.Model(p).Updates(map[string]interface{}{
+				"name":        p.Name,
+				"brand":       p.Brand,
+				"description": p.Description,
+				"category_id": p.CategoryID,
+				"category":    p.Category,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		if categoriesChanged {
+			if err := tx.Delete(&Category{}, "product_id = ?", p.ID).Error; err != nil {
+				return err
+			}
+			if len(p.Categories) > 0 {
+				if err := tx.Create(&p.Categories).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if specsChanged {
+			if err := tx.Delete(&Spec{}, "product_id = ?", p.ID).Error; err != nil {
+				return err
+			}
+			if len(p.Specs) > 0 {
+				if err := tx.Create(&p.Specs).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// sameCategories returns true if both are the same breadcrumb, ids are not compared
+func sameCategories(stored, parsed []Category) bool {
+	if len(stored) != len(parsed) {
+		return false
+	}
+	for i := range stored {
+		if stored[i].Level != parsed[i].Level || stored[i].CategoryID != parsed[i].CategoryID || stored[i].Name != parsed[i].Name {
+			return false
+		}
+	}
+	return true
+}
+
+// sameSpecs returns true if both are the same spec sheet, ids are not compared
+func sameSpecs(stored, parsed []Spec) bool {
+	if len(stored) != len(parsed) {
+		return false
+	}
+	for i := range stored {
+		if stored[i].Position != parsed[i].Position || stored[i].Name != parsed[i].Name || stored[i].Value != parsed[i].Value {
+			return false
+		}
+	}
+	return true
+}
+
+// MigrateStockState fills stock state of price history recorded before
+// it was introduced, when stock was 99 if available and 0 if not
+func MigrateStockState(dbClient *gorm.DB) error {
+	return dbClient.Model(&Price{}).
+		Where("stock_state IS NULL OR stock_state = ''").
+		UpdateColumns(map[string]interface{}{
+			"stock_state": gorm.Expr("CASE WHEN stock = 99 THEN ? WHEN stock = 0 THEN ? ELSE ? END",
+				crawler.InStock, crawler.SoldOut, crawler.LowStock),
+			"stock": gorm.Expr("CASE WHEN stock = 99 THEN 0 ELSE stock END"),
+		}).Error
 }
 
+// updateWindow is the time taken to record prices of a product in one update
+const updateWindow = 10 * time.Minute
+
 var EMPTY_PRODUCT = errors.New("no product info for creation")
 
 // New accepts *crawler.Result and returns *Product
@@ -39,27 +266,39 @@ func New(dbClient *gorm.DB, result *crawler.Result) (*Product, error) {
 		return nil, EMPTY_PRODUCT
 	}
 
-	styles := make([]Style, len(result.Product.Styles))
-	for i, style := range result.Product.Styles {
+	parsed, _ := crawler.RejectImplausible(result.Product, nil)
+
+	now := time.Now()
+	styles := make([]Style, len(parsed.Styles))
+	for i, style := range parsed.Styles {
 		styles[i] = Style{
 			StyleCode: style.StyleCode,
 			ImageUrl:  style.ImageUrl,
 			Colour:    style.Colour,
 			Size:      style.Size,
-			PriceHistories: []Price{
-				{
-					Price: style.Price,
-					Stock: style.Stock,
-				},
-			},
 		}
+		// rejected prices are never recorded
+		if style.Rejected == "" {
+			price := newPrice(0, &style)
+			price.FirstSeen, price.LastSeen = now, now
+			styles[i].PriceHistories = []Price{price}
+		} else {
+			styles[i].Rejections = []RejectedObservation{newRejection(0, &style, now)}
+		}
+	}
+
+	site := result.Site
+	if site == "" {
+		site = crawler.DEFAULT_SITE
 	}
 
 	p := &Product{
 		Name:        result.Product.Name,
+		SourceSite:  site,
 		ProductCode: result.ProductCode,
 		Styles:      styles,
 	}
+	p.setDetails(result.Product)
 
 	err := p.Save(dbClient)
 	if err != nil {
@@ -70,9 +309,9 @@ func New(dbClient *gorm.DB, result *crawler.Result) (*Product, error) {
 }
 
 // return product only, corresponsing styles, price and stock will not included
-func GetProductByCode(dbClient *gorm.DB, productCode string) (*Product, error) {
+func GetProductByCode(dbClient *gorm.DB, site, productCode string) (*Product, error) {
 	p := Product{}
-	r := dbClient.Where("product_code = ?", productCode).Limit(1).Find(&p)
+	r := dbClient.Where("source_site = ? AND product_code = ?", site, productCode).Limit(1).Find(&p)
 	if r.Error == nil && r.RowsAffected == 0 {
 		return nil, gorm.ErrRecordNotFound
 	}
@@ -89,6 +328,16 @@ func GetProductById(dbClient *gorm.DB, pid uint) (*Product, error) {
 	return &p, r.Error
 }
 
+// return style only, price history will not included
+func GetStyleById(dbClient *gorm.DB, id uint) (*Style, error) {
+	s := Style{}
+	r := dbClient.Where("id = ?", id).Limit(1).Find(&s)
+	if r.Error == nil && r.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &s, r.Error
+}
+
 // Get styles
 // key = colour-size
 func (p *Product) AllStyles(dbClient *gorm.DB) (map[string]*Style, error) {
@@ -107,6 +356,55 @@ func (p *Product) AllStyles(dbClient *gorm.DB) (map[string]*Style, error) {
 	return nil, r.Error
 }
 
+// CurrentStyleCount returns number of styles recorded in the last update,
+// styles removed from the site earlier are not counted
+func (p *Product) CurrentStyleCount(dbClient *gorm.DB) (int, error) {
+	last := sql.NullTime{}
+	err := dbClient.Model(&Price{}).
+		Joins("JOIN styles ON styles.id = prices.style_id").
+		Where("styles.product_id = ? AND styles.deleted_at IS NULL", p.ID).
+		Select("MAX(prices.last_seen)").
+		Scan(&last).Error
+	if err != nil || !last.Valid {
+		return 0, err
+	}
+
+	// prices of the same update are recorded within seconds
+	var count int64
+	err = dbClient.Model(&Price{}).
+		Joins("JOIN styles ON styles.id = prices.style_id").
+		Where("styles.product_id = ? AND styles.deleted_at IS NULL AND prices.last_seen >= ?", p.ID, last.Time.Add(-updateWindow)).
+		Distinct("prices.style_id").
+		Count(&count).Error
+	return int(count), err
+}
+
+// findStyle returns the style stored matches the style parsed,
+// styles without colour and size, i.e. found by structured data
+// only, are matched by style code
+func findStyle(storedStyles map[string]*Style, style *crawler.Style) (*Style, bool) {
+	if style.Colour != "" || style.Size != "" {
+		dbStyle, ok := storedStyles[style.Colour+"-"+style.Size]
+		return dbStyle, ok
+	}
+	for _, dbStyle := range storedStyles {
+		if dbStyle.StyleCode == style.StyleCode {
+			return dbStyle, true
+		}
+	}
+	return nil, false
+}
+
+// StyleByCode returns style of the style code, i.e. the last 5 digits of sku
+func (p *Product) StyleByCode(dbClient *gorm.DB, styleCode string) (*Style, error) {
+	s := Style{}
+	r := dbClient.Where("product_id = ? AND style_code = ?", p.ID, styleCode).Limit(1).Find(&s)
+	if r.Error == nil && r.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &s, r.Error
+}
+
 func (p *Product) Style(dbClient *gorm.DB, colour, size string) (*Style, error) {
 	s := Style{}
 	r := dbClient.Where("product_id = ? AND colour = ? AND size = ?", p.ID, colour, size).Limit(1).Find(&s)
@@ -116,9 +414,77 @@ func (p *Product) Style(dbClient *gorm.DB, colour, size string) (*Style, error)
 	return &s, r.Error
 }
 
+// StylesWithoutImage returns styles of which image not mirrored and
+// not attempted since checkedBefore, at most limit styles returned
+func StylesWithoutImage(dbClient *gorm.DB, checkedBefore time.Time, limit int) ([]Style, error) {
+	styles := []Style{}
+	r := dbClient.Where("image_url <> '' AND (image_hash IS NULL OR image_hash = '')").
+		Where("image_checked_at IS NULL OR image_checked_at < ?", checkedBefore).
+		Order("id").Limit(limit).Find(&styles)
+	return styles, r.Error
+}
+
+// SetImageHash records the attempt to mirror the image,
+// hash is empty if failed
+func (s *Style) SetImageHash(dbClient *gorm.DB, hash string) error {
+	now := time.Now()
+	s.ImageHash, s.ImageCheckedAt = hash, &now
+	return dbClient.Model(s).UpdateColumns(map[string]interface{}{
+		"image_hash":       hash,
+		"image_checked_at": now,
+	}).Error
+}
+
+// LatestPrices returns the latest price recorded of each style, key = style id
+func (p *Product) LatestPrices(dbClient *gorm.DB) (map[uint]Price, error) {
+	return p.latestPrices(dbClient, false)
+}
+
+// latestPrices returns the latest price recorded of each style,
+// prices of 0 are skipped if pricedOnly
+func (p *Product) latestPrices(dbClient *gorm.DB, pricedOnly bool) (map[uint]Price, error) {
+	latest := dbClient.Model(&Price{}).
+		Joins("JOIN styles ON styles.id = prices.style_id").
+		Where("styles.product_id = ? AND styles.deleted_at IS NULL", p.ID).
+		Select("prices.style_id, MAX(prices.last_seen) AS latest").
+		Group("prices.style_id")
+	if pricedOnly {
+		latest = latest.Where("prices.price > 0")
+	}
+	query := dbClient.
+		Joins("JOIN (?) latestPrice ON prices.style_id = latestPrice.style_id AND prices.last_seen = latestPrice.latest", latest)
+	if pricedOnly {
+		query = query.Where("prices.price > 0")
+	}
+
+	prices := []Price{}
+	if err := query.Find(&prices).Error; err != nil {
+		return nil, err
+	}
+
+	priceMap := make(map[uint]Price, len(prices))
+	for _, price := range prices {
+		// the one created later if more than one
+		if last, ok := priceMap[price.StyleID]; !ok || price.ID > last.ID {
+			priceMap[price.StyleID] = price
+		}
+	}
+	return priceMap, nil
+}
+
+// PriceHistoryBetween returns intervals of prices observed within
+// the time range, from the earliest
+func (s *Style) PriceHistoryBetween(dbClient *gorm.DB, from, to time.Time) ([]Price, error) {
+	prices := []Price{}
+	err := dbClient.Where("style_id = ? AND first_seen <= ? AND last_seen >= ?", s.ID, to, from).
+		Order("first_seen, id").Find(&prices).Error
+	return prices, err
+}
+
+// PriceHistory returns intervals of prices recorded, from the earliest
 func (s *Style) PriceHistory(dbClient *gorm.DB) ([]Price, error) {
 	prices := []Price{}
-	r := dbClient.Where("style_id = ?", s.ID).Find(&prices)
+	r := dbClient.Where("style_id = ?", s.ID).Order("first_seen, id").Find(&prices)
 
 	if r.Error == nil && r.RowsAffected > 0 {
 		return prices, nil
@@ -138,12 +504,21 @@ func (p *Product) Delete(dbClient *gorm.DB) error {
 			if err := tx.Delete(&Price{}, "style_id = ?", style.ID).Error; err != nil {
 				return err
 			}
+			if err := tx.Delete(&RejectedObservation{}, "style_id = ?", style.ID).Error; err != nil {
+				return err
+			}
 			if err := tx.Delete(style).Error; err != nil {
 				return err
 			}
 
 		}
 
+		if err := tx.Delete(&Category{}, "product_id = ?", p.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&Spec{}, "product_id = ?", p.ID).Error; err != nil {
+			return err
+		}
 		if err := tx.Delete(p).Error; err != nil {
 			return err
 		}
@@ -152,20 +527,28 @@ func (p *Product) Delete(dbClient *gorm.DB) error {
 	})
 }
 
+// Update records prices and stock of the result, price history of a style
+// is extended if nothing changed, new interval started if not
 func (p *Product) Update(dbClient *gorm.DB, result *crawler.Result) error {
+	now := time.Now()
 
-	// product has been removed, set price == 0 and stock == 0 for all styles
+	// product has been removed, styles are discontinued at the last price
 	if result.Err == crawler.PRODUCT_NOT_FOUND {
-		for idx := range p.Styles {
-			p.Styles[idx].PriceHistories = append(p.Styles[idx].PriceHistories, Price{Price: 0, Stock: 0})
+		latest, err := p.LatestPrices(dbClient)
+		if err != nil {
+			return err
 		}
-		dbClient.Save(p)
-		return nil
+		return recordPrices(dbClient, latest, discontinued(latest), now)
 	}
 
-	// update product name
-	if p.Name != result.Product.Name {
-		p.Name = result.Product.Name
+	// nothing changed since last scraping, prices are still seen
+	if result.Unchanged {
+		return p.extendPrices(dbClient, now)
+	}
+
+	// update product name and details
+	if err := p.updateDetails(dbClient, result.Product); err != nil {
+		return err
 	}
 
 	// get all styles of current product
@@ -174,18 +557,45 @@ func (p *Product) Update(dbClient *gorm.DB, result *crawler.Result) error {
 		return err
 	}
 
-	// add price history
+	// compare with prices stored as the crawler may not know them, i.e. after restart
+	latest, err := p.LatestPrices(dbClient)
+	if err != nil {
+		return err
+	}
+	// prices of 0 were recorded for removed products before, never compared with
+	priced, err := p.latestPrices(dbClient, true)
+	if err != nil {
+		return err
+	}
+	parsed, _ := crawler.RejectImplausible(result.Product, func(style *crawler.Style) uint {
+		if dbStyle, ok := findStyle(storedStyles, style); ok {
+			return priced[dbStyle.ID].Price
+		}
+		return 0
+	})
+
+	// add price history, rejected prices are never recorded
 	batchPrice := []Price{}
 	batchStyle := []Style{}
-	for _, style := range result.Product.Styles {
-		key := style.Colour + "-" + style.Size
-		if dbStyle, ok := storedStyles[key]; ok {
-			newPrice := Price{
-				StyleID: dbStyle.ID,
-				Price:   style.Price,
-				Stock:   style.Stock,
-			}
-			batchPrice = append(batchPrice, newPrice)
+	batchRejected := []RejectedObservation{}
+	for _, style := range parsed.Styles {
+		if dbStyle, ok := findStyle(storedStyles, &style); ok {
+			if style.Rejected == "" {
+				batchPrice = append(batchPrice, newPrice(dbStyle.ID, &style))
+			} else {
+				batchRejected = append(batchRejected, newRejection(dbStyle.ID, &style, now))
+			}
+
+			// image replaced, mirror it again
+			if style.ImageUrl != "" && dbStyle.ImageUrl != style.ImageUrl {
+				if err := dbClient.Model(dbStyle).UpdateColumns(map[string]interface{}{
+					"image_url":        style.ImageUrl,
+					"image_hash":       "",
+					"image_checked_at": nil,
+				}).Error; err != nil {
+					return err
+				}
+			}
 		} else {
 			// create new style
 			newStyle := Style{
@@ -194,22 +604,125 @@ func (p *Product) Update(dbClient *gorm.DB, result *crawler.Result) error {
 				ProductID: p.ID,
 				Colour:    style.Colour,
 				Size:      style.Size,
-				PriceHistories: []Price{{
-					Price: style.Price,
-					Stock: style.Stock,
-				}},
+			}
+			if style.Rejected == "" {
+				price := newPrice(0, &style)
+				price.FirstSeen, price.LastSeen = now, now
+				newStyle.PriceHistories = []Price{price}
+			} else {
+				newStyle.Rejections = []RejectedObservation{newRejection(0, &style, now)}
 			}
 			batchStyle = append(batchStyle, newStyle)
 		}
 	}
 
 	if len(batchStyle) > 0 {
-		dbClient.Create(&batchStyle)
+		if err := dbClient.Create(&batchStyle).Error; err != nil {
+			return err
+		}
 	}
-	if len(batchPrice) > 0 {
-		dbClient.Create(&batchPrice)
+	if len(batchRejected) > 0 {
+		if err := dbClient.Create(&batchRejected).Error; err != nil {
+			return err
+		}
 	}
-	return nil
+	return recordPrices(dbClient, latest, batchPrice, now)
+}
+
+// Replay rewrites styles and price history recorded around the time
+// the page was fetched with the result parsed from its snapshot.
+// Interval recorded within window from the time will be replaced, or split
+// if it lasted longer, new price will be added if nothing recorded.
+// It returns number of prices updated and created.
+func (p *Product) Replay(dbClient *gorm.DB, result *crawler.Result, at time.Time, window time.Duration) (updated, created int, err error) {
+	if result.Product == nil {
+		return 0, 0, EMPTY_PRODUCT
+	}
+
+	storedStyles, err := p.AllStyles(dbClient)
+	if err != nil {
+		return 0, 0, err
+	}
+	parsed, _ := crawler.RejectImplausible(result.Product, nil)
+
+	err = dbClient.Transaction(func(tx *gorm.DB) error {
+		for _, style := range parsed.Styles {
+			dbStyle, ok := findStyle(storedStyles, &style)
+			if !ok {
+				// style missed at that time, i.e. parser bug
+				dbStyle = &Style{
+					ProductID: p.ID,
+					StyleCode: style.StyleCode,
+					ImageUrl:  style.ImageUrl,
+					Colour:    style.Colour,
+					Size:      style.Size,
+				}
+				if err := tx.Create(dbStyle).Error; err != nil {
+					return err
+				}
+			} else if dbStyle.StyleCode != style.StyleCode || dbStyle.ImageUrl != style.ImageUrl {
+				if dbStyle.ImageUrl != style.ImageUrl {
+					dbStyle.ImageHash, dbStyle.ImageCheckedAt = "", nil
+				}
+				dbStyle.StyleCode = style.StyleCode
+				dbStyle.ImageUrl = style.ImageUrl
+				if err := tx.Save(dbStyle).Error; err != nil {
+					return err
+				}
+			}
+
+			// rejected prices are never recorded
+			if style.Rejected != "" {
+				continue
+			}
+
+			// interval recorded nearest to the time
+			price := Price{}
+			r := tx.Where("style_id = ? AND first_seen <= ? AND last_seen >= ?", dbStyle.ID, at.Add(window), at.Add(-window)).
+				Order(gorm.Expr("CASE WHEN ? BETWEEN first_seen AND last_seen THEN 0 ELSE LEAST(ABS(TIMESTAMPDIFF(SECOND, first_seen, ?)), ABS(TIMESTAMPDIFF(SECOND, last_seen, ?))) END", at, at, at)).
+				Limit(1).Find(&price)
+			if r.Error != nil {
+				return r.Error
+			}
+
+			replayed := newPrice(dbStyle.ID, &style)
+			if r.RowsAffected == 0 {
+				replayed.FirstSeen, replayed.LastSeen = at, at
+				replayed.CreatedAt, replayed.UpdatedAt = at, at
+				if err := tx.Create(&replayed).Error; err != nil {
+					return err
+				}
+				created++
+				continue
+			}
+
+			if !price.sameAs(&replayed) {
+				inPlace, err := replayPrice(tx, &price, replayed, at, window)
+				if err != nil {
+					return err
+				}
+				if inPlace {
+					updated++
+				} else {
+					created++
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return updated, created, nil
+}
+
+// sameDate returns true if both are nil or on the same date
+func sameDate(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Format("2006-01-02") == b.Format("2006-01-02")
 }
 
 func (p *Product) Save(dbClient *gorm.DB) error {
@@ -0,0 +1,68 @@
+package product
+
+import (
+	"testing"
+	"time"
+
+	"github.com/knchan0x/belle-maison/backend/internal/crawler"
+	"gorm.io/gorm"
+)
+
+func TestSameDetails(t *testing.T) {
+	parsed := &Product{}
+	parsed.setDetails(&crawler.Product{
+		Breadcrumb: []crawler.Category{{ID: "10", Name: "コスメ/美容/健康"}, {ID: "1009", Name: "健康家電/健康用品"}},
+		Specs:      []crawler.Spec{{Name: "サイズ", Value: "約47×5×90cm"}},
+	})
+
+	// stored rows have ids and times
+	categories := []Category{
+		{Model: gorm.Model{ID: 1}, Level: 0, CategoryID: "10", Name: "コスメ/美容/健康"},
+		{Model: gorm.Model{ID: 2}, Level: 1, CategoryID: "1009", Name: "健康家電/健康用品"},
+	}
+	specs := []Spec{{Model: gorm.Model{ID: 1}, Position: 0, Name: "サイズ", Value: "約47×5×90cm"}}
+	if !sameCategories(categories, parsed.Categories) || !sameSpecs(specs, parsed.Specs) {
+		t.Errorf("details not changed are rewritten")
+	}
+
+	if sameCategories(categories[:1], parsed.Categories) {
+		t.Errorf("breadcrumb changed not detected")
+	}
+	specs[0].Value = "約50×5×90cm"
+	if sameSpecs(specs, parsed.Specs) {
+		t.Errorf("spec changed not detected")
+	}
+}
+
+func TestDiscontinued(t *testing.T) {
+	latest := map[uint]Price{
+		2: {Model: gorm.Model{ID: 12}, StyleID: 2, Price: 900, RegularPrice: 1000, Discount: 10, StockState: crawler.LowStock, Stock: 3},
+		1: {Model: gorm.Model{ID: 11}, StyleID: 1, Price: 1000, RegularPrice: 1000, StockState: crawler.InStock},
+	}
+
+	prices := discontinued(latest)
+	if len(prices) != 2 || prices[0].StyleID != 1 || prices[1].StyleID != 2 {
+		t.Fatalf("unexpected prices of styles removed: %+v", prices)
+	}
+	for _, p := range prices {
+		last := latest[p.StyleID]
+		if p.ID != 0 || p.Price != last.Price || p.RegularPrice != last.RegularPrice || p.Discount != last.Discount {
+			t.Errorf("last price of style %d not kept: %+v", p.StyleID, p)
+		}
+		if p.StockState != crawler.Discontinued || p.Stock != 0 || p.RestockDate != nil {
+			t.Errorf("style %d not discontinued: %+v", p.StyleID, p)
+		}
+	}
+
+	// removed again, the discontinued interval is extended
+	at := baseTime.Add(24 * time.Hour)
+	_, created := planRecord(latest, prices, at)
+	for i := range created {
+		created[i].ID = uint(21 + i)
+		latest[created[i].StyleID] = created[i]
+	}
+	extended, created := planRecord(latest, discontinued(latest), at.Add(time.Hour))
+	if len(extended) != 2 || len(created) != 0 {
+		t.Errorf("expected 2 intervals extended, got %v, created %d", extended, len(created))
+	}
+}
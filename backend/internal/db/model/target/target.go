@@ -3,12 +3,16 @@ package target
 import (
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/knchan0x/belle-maison/backend/internal/crawler"
+	"github.com/knchan0x/belle-maison/backend/internal/imagestore"
 	"gorm.io/gorm"
 )
 
 type Target struct {
 	gorm.Model
+	SourceSite  string `gorm:"default:bellemaison"`
 	ProductCode string
 	ProductID   uint
 	StyleID     uint
@@ -16,18 +20,63 @@ type Target struct {
 }
 
 type TargetInfo struct {
-	ID          uint
-	ProductCode string
-	Name        string
-	Colour      string
-	Size        string
-	ImageUrl    string
-	TargetPrice uint
-	Price       uint
-	Stock       uint
+	ID           uint
+	SourceSite   string
+	ProductCode  string
+	ProductID    uint
+	StyleID      uint // for price history
+	Name         string
+	Brand        string
+	CategoryID   string   // lowest level of breadcrumb
+	Category     string   // name of CategoryID
+	Categories   []string `gorm:"-"` // category ids of all levels, from top level
+	Colour       string
+	Size         string
+	ImageUrl     string
+	ImageHash    string `json:"-"` // hash of local copy, see UseLocalImage
+	ThumbnailUrl string // empty if no local copy
+	TargetPrice  uint
+	Price        uint
+	RegularPrice uint
+	SalePrice    uint
+	Discount     uint // in percent
+	Points       uint
+	StockState   crawler.StockState
+	Stock        uint       // items left, low stock only
+	RestockDate  *time.Time // expected restock date of backorder
+	StockText    string     // i.e. "3 left", "back in stock on 11/20"
+}
+
+// InCategory returns true if the product is under the category of any level
+func (t *TargetInfo) InCategory(categoryID string) bool {
+	for _, id := range t.Categories {
+		if id == categoryID {
+			return true
+		}
+	}
+	return false
+}
+
+// UseLocalImage replaces image url with the one of local copy if it exists,
+// url returns url of the image or its thumbnail by hash
+func (t *TargetInfo) UseLocalImage(store *imagestore.Store, url func(hash string, thumbnail bool) string) {
+	if store == nil || !store.Has(t.ImageHash) {
+		return
+	}
+	t.ImageUrl = url(t.ImageHash, false)
+	t.ThumbnailUrl = url(t.ImageHash, true)
+}
+
+// StockStatus returns stock status of the latest price
+func (t *TargetInfo) StockStatus() crawler.StockStatus {
+	return crawler.StockStatus{
+		State:        t.StockState,
+		Quantity:     t.Stock,
+		ExpectedDate: t.RestockDate,
+	}
 }
 
-func New(dbClient *gorm.DB, productCode string, productID uint, styleId uint, price uint) (*Target, error) {
+func New(dbClient *gorm.DB, site, productCode string, productID uint, styleId uint, price uint) (*Target, error) {
 
 	// check duplicate
 	if t, err := getByStyleId(dbClient, styleId); !errors.Is(err, gorm.ErrRecordNotFound) {
@@ -36,6 +85,7 @@ func New(dbClient *gorm.DB, productCode string, productID uint, styleId uint, pr
 
 	// create target
 	newTarget := Target{
+		SourceSite:  site,
 		ProductCode: productCode,
 		ProductID:   productID,
 		StyleID:     styleId,
@@ -54,39 +104,74 @@ func New(dbClient *gorm.DB, productCode string, productID uint, styleId uint, pr
 // Get all targets' product info
 func GetAll(dbClient *gorm.DB) (results []TargetInfo) {
 	latestPrice := dbClient.Table("prices").
-		Select("style_id, MAX(updated_at) as latest").
+		Select("style_id, MAX(last_seen) as latest").
+		Where("deleted_at IS NULL").
 		Group("style_id")
 
 	priceList := dbClient.Table("prices").
-		Select("prices.style_id, prices.price, prices.stock, prices.updated_at").
-		Joins("INNER JOIN (?) latestPrice ON prices.style_id = latestPrice.style_id AND prices.updated_at = latestPrice.latest", latestPrice).
-		Group("prices.style_id, prices.price, prices.stock")
+		Select("prices.style_id, prices.price, prices.regular_price, prices.sale_price, prices.discount, prices.points, prices.stock_state, prices.stock, prices.restock_date, prices.last_seen").
+		Joins("INNER JOIN (?) latestPrice ON prices.style_id = latestPrice.style_id AND prices.last_seen = latestPrice.latest", latestPrice).
+		Where("prices.deleted_at IS NULL").
+		Group("prices.style_id, prices.price, prices.regular_price, prices.sale_price, prices.discount, prices.points, prices.stock_state, prices.stock, prices.restock_date")
 
 	styles := dbClient.Table("styles").
-		Select("styles.id, styles.product_id, styles.colour, styles.size, styles.image_url, priceList.price, priceList.stock").
+		Select("styles.id, styles.product_id, styles.colour, styles.size, styles.image_url, styles.image_hash, priceList.price, priceList.regular_price, priceList.sale_price, priceList.discount, priceList.points, priceList.stock_state, priceList.stock, priceList.restock_date").
 		Joins("LEFT JOIN (?) priceList ON styles.id = priceList.style_id", priceList)
 
 	products := dbClient.Table("products").
-		Select("products.id AS productId, products.name, styleList.id AS styleId, styleList.colour, styleList. `size`, styleList.image_url, styleList.price, styleList.stock").
+		Select("products.id AS productId, products.name, products.brand, products.category_id, products.category, styleList.id AS styleId, styleList.colour, styleList. `size`, styleList.image_url, styleList.image_hash, styleList.price, styleList.regular_price, styleList.sale_price, styleList.discount, styleList.points, styleList.stock_state, styleList.stock, styleList.restock_date").
 		Joins("RIGHT JOIN (?) styleList ON styleList.product_id = products.id", styles)
 
 	r := dbClient.Table("targets").
-		Select("targets.id, targets.product_code, targets.target_price, productList. `name`, productList.colour, productList. `size`, productList.image_url, productList.price, productList.stock").
+		Select("targets.id, targets.source_site, targets.product_code, targets.product_id, targets.style_id, targets.target_price, productList. `name`, productList.brand, productList.category_id, productList.category, productList.colour, productList. `size`, productList.image_url, productList.image_hash, productList.price, productList.regular_price, productList.sale_price, productList.discount, productList.points, productList.stock_state, productList.stock, productList.restock_date").
 		Joins("LEFT JOIN (?) productList ON productList.styleId = targets.style_id", products).
 		Where("targets.deleted_at IS NULL").
 		Order("targets.id DESC").
 		Scan(&results)
 
 	if r.Error == nil && r.RowsAffected > 0 {
+		for idx := range results {
+			results[idx].StockText = results[idx].StockStatus().String()
+		}
+		setCategories(dbClient, results)
 		return results
 	}
 	return nil
 }
 
-// Get all targets' product code
+// setCategories sets category ids of all levels of the products
+func setCategories(dbClient *gorm.DB, targets []TargetInfo) {
+	ids := make([]uint, len(targets))
+	for idx := range targets {
+		ids[idx] = targets[idx].ProductID
+	}
+
+	categories := []struct {
+		ProductID  uint
+		CategoryID string
+	}{}
+	r := dbClient.Table("product_categories").
+		Select("product_id, category_id").
+		Where("product_id IN ? AND deleted_at IS NULL", ids).
+		Order("product_id, level").
+		Scan(&categories)
+	if r.Error != nil {
+		return
+	}
+
+	byProduct := make(map[uint][]string)
+	for _, c := range categories {
+		byProduct[c.ProductID] = append(byProduct[c.ProductID], c.CategoryID)
+	}
+	for idx := range targets {
+		targets[idx].Categories = byProduct[targets[idx].ProductID]
+	}
+}
+
+// Get all targets' product code, qualified by site if necessary
 func GetList(dbClient *gorm.DB) []string {
 	t := []Target{}
-	r := dbClient.Select("product_code").Find(&t)
+	r := dbClient.Select("source_site", "product_code").Find(&t)
 	if r.Error == nil && r.RowsAffected > 0 {
 		return targetToList(t)
 	}
@@ -99,14 +184,14 @@ func targetToList(targets []Target) (list []string) {
 	}
 
 	for _, target := range targets {
-		list = append(list, target.ProductCode)
+		list = append(list, crawler.JoinCode(target.SourceSite, target.ProductCode))
 	}
 	return
 }
 
-func getByProductCode(dbClient *gorm.DB, productCode string) (*Target, error) {
+func getByProductCode(dbClient *gorm.DB, site, productCode string) (*Target, error) {
 	t := Target{}
-	r := dbClient.Where("product_code = ?", productCode).Limit(1).Find(&t)
+	r := dbClient.Where("source_site = ? AND product_code = ?", site, productCode).Limit(1).Find(&t)
 	if r.Error == nil && r.RowsAffected == 0 {
 		return nil, gorm.ErrRecordNotFound
 	}
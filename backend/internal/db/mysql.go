@@ -59,7 +59,7 @@ func NewGORMClient(settings *DbSettings) (*gorm.DB, error) {
 }
 
 // Auto migrate following schemas:
-// Product, Style, Price, Target
+// Product, Style, Price, Category, Spec, RejectedObservation, Target
 func Migrate(dbClient *gorm.DB) {
 	if err := dbClient.AutoMigrate(&p.Product{}); err != nil {
 		log.Panicf("failed to migrate Product: %v", err)
@@ -70,6 +70,21 @@ func Migrate(dbClient *gorm.DB) {
 	if err := dbClient.AutoMigrate(&p.Price{}); err != nil {
 		log.Panicf("failed to migrate Price: %v", err)
 	}
+	if err := dbClient.AutoMigrate(&p.Category{}, &p.Spec{}); err != nil {
+		log.Panicf("failed to migrate Category and Spec: %v", err)
+	}
+	if err := dbClient.AutoMigrate(&p.RejectedObservation{}); err != nil {
+		log.Panicf("failed to migrate RejectedObservation: %v", err)
+	}
+	if err := p.MigrateStockState(dbClient); err != nil {
+		log.Panicf("failed to migrate stock state of Price: %v", err)
+	}
+	if err := dbClient.AutoMigrate(&Migration{}); err != nil {
+		log.Panicf("failed to migrate Migration: %v", err)
+	}
+	if err := runOnce(dbClient, MIGRATION_COMPRESS_PRICE_HISTORY, p.CompressPriceHistory); err != nil {
+		log.Panicf("failed to compress price history: %v", err)
+	}
 	if err := dbClient.AutoMigrate(&t.Target{}); err != nil {
 		log.Panicf("failed to migrate Target: %v", err)
 	}
@@ -0,0 +1,184 @@
+package imagestore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+const (
+	MaxImageSize  = 10 << 20 // bytes, larger images are rejected
+	MaxImageSide  = 8000     // px of width and height, larger images are rejected before decoded
+	ThumbnailSize = 240      // px of the longer side
+	FetchTimeout  = 30 * time.Second
+
+	thumbnailQuality = 80
+	thumbnailSuffix  = "_thumb.jpg"
+)
+
+var (
+	ErrNotImage     = errors.New("not a supported image")
+	ErrTooLarge     = errors.New("image too large")
+	ErrInvalidHash  = errors.New("invalid image hash")
+	ErrImageMissing = errors.New("image not stored")
+
+	hashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+// HTTPClient is the interface of client used to download images
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Store keeps images under dir, named by sha256 of the content,
+// i.e. dir/ab/abcd...ef, with a jpeg thumbnail next to the image
+type Store struct {
+	dir    string
+	client HTTPClient
+}
+
+// New returns store of dir, dir will be created if not exists.
+// Default http client will be used if client is nil.
+func New(dir string, client HTTPClient) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = &http.Client{Timeout: FetchTimeout}
+	}
+	return &Store{dir: dir, client: client}, nil
+}
+
+// Put saves the image and its thumbnail, it returns hash of the image.
+// Images stored already are not written again.
+func (s *Store) Put(r io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxImageSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > MaxImageSize {
+		return "", ErrTooLarge
+	}
+
+	// decompression bombs are small in bytes
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNotImage, err)
+	}
+	if config.Width > MaxImageSide || config.Height > MaxImageSide {
+		return "", fmt.Errorf("%w: %dx%d", ErrTooLarge, config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNotImage, err)
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if s.Has(hash) {
+		return hash, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path(hash)), 0o755); err != nil {
+		return "", err
+	}
+
+	// thumbnail first, image exists only if both are written
+	thumb := bytes.Buffer{}
+	if err := jpeg.Encode(&thumb, Thumbnail(img, ThumbnailSize), &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return "", err
+	}
+	if err := writeFile(s.path(hash)+thumbnailSuffix, thumb.Bytes()); err != nil {
+		return "", err
+	}
+	if err := writeFile(s.path(hash), data); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// Fetch downloads the image and saves it, it returns hash of the image
+func (s *Store) Fetch(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetch %s: %d %s", url, resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	return s.Put(resp.Body)
+}
+
+// Has returns true if the image and its thumbnail are stored
+func (s *Store) Has(hash string) bool {
+	if !hashPattern.MatchString(hash) {
+		return false
+	}
+	for _, path := range []string{s.path(hash), s.path(hash) + thumbnailSuffix} {
+		if _, err := os.Stat(path); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Path returns file path of the image, or its thumbnail if thumbnail is true
+func (s *Store) Path(hash string, thumbnail bool) (string, error) {
+	if !hashPattern.MatchString(hash) {
+		return "", ErrInvalidHash
+	}
+	if !s.Has(hash) {
+		return "", ErrImageMissing
+	}
+	if thumbnail {
+		return s.path(hash) + thumbnailSuffix, nil
+	}
+	return s.path(hash), nil
+}
+
+func (s *Store) path(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash)
+}
+
+// writeFile writes to a temp file then renames it,
+// readers never see a partially written file
+func writeFile(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
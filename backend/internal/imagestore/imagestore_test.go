@@ -0,0 +1,123 @@
+package imagestore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func testImage(t *testing.T, w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 0, 0xff})
+		}
+	}
+	buf := bytes.Buffer{}
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPut(t *testing.T) {
+	store, err := New(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := testImage(t, 600, 300)
+	hash, err := store.Put(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to put image: %v", err)
+	}
+	if !store.Has(hash) {
+		t.Fatalf("image %s not stored", hash)
+	}
+
+	// content addressed
+	if again, err := store.Put(bytes.NewReader(data)); err != nil || again != hash {
+		t.Errorf("same image stored as %s, expected %s: %v", again, hash, err)
+	}
+
+	path, _ := store.Path(hash, false)
+	if stored, _ := os.ReadFile(path); !bytes.Equal(stored, data) {
+		t.Error("image changed")
+	}
+
+	path, _ = store.Path(hash, true)
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	thumb, err := jpeg.DecodeConfig(f)
+	if err != nil || thumb.Width != ThumbnailSize || thumb.Height != ThumbnailSize/2 {
+		t.Errorf("unexpected thumbnail: %+v, %v", thumb, err)
+	}
+
+	// decompression bomb, header of a small image patched to be huge
+	bomb := testImage(t, 1, 1)
+	ihdr := bomb[8+8 : 8+8+13] // after signature, length and type
+	binary.BigEndian.PutUint32(ihdr[0:], 100000)
+	binary.BigEndian.PutUint32(ihdr[4:], 100000)
+	binary.BigEndian.PutUint32(bomb[8+8+13:], crc32.ChecksumIEEE(bomb[8+4:8+8+13]))
+	if _, err := store.Put(bytes.NewReader(bomb)); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("huge image accepted: %v", err)
+	}
+
+	if _, err := store.Put(strings.NewReader("<html></html>")); !errors.Is(err, ErrNotImage) {
+		t.Errorf("non image accepted: %v", err)
+	}
+	if _, err := store.Path("../../etc/passwd", false); !errors.Is(err, ErrInvalidHash) {
+		t.Errorf("invalid hash accepted: %v", err)
+	}
+	if _, err := store.Path(strings.Repeat("0", 64), false); !errors.Is(err, ErrImageMissing) {
+		t.Errorf("missing image found: %v", err)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	data := testImage(t, 10, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/image.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	store, _ := New(t.TempDir(), nil)
+	hash, err := store.Fetch(context.Background(), srv.URL+"/image.png")
+	if err != nil || !store.Has(hash) {
+		t.Errorf("failed to fetch image: %v", err)
+	}
+	if _, err := store.Fetch(context.Background(), srv.URL+"/removed.png"); err == nil {
+		t.Error("expected error of 404")
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	for _, c := range []struct{ w, h, tw, th int }{
+		{480, 960, 120, 240},
+		{1000, 3, 240, 1},
+		{100, 50, 100, 50},
+	} {
+		bounds := Thumbnail(image.NewRGBA(image.Rect(0, 0, c.w, c.h)), 240).Bounds()
+		if bounds.Dx() != c.tw || bounds.Dy() != c.th {
+			t.Errorf("%dx%d: expected %dx%d, got %dx%d", c.w, c.h, c.tw, c.th, bounds.Dx(), bounds.Dy())
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package imagestore
+
+import (
+	"image"
+	"image/color"
+)
+
+// Thumbnail scales img down to fit in size x size by averaging the pixels
+// covered, images smaller than size are copied as is. Transparent pixels
+// are filled with white.
+func Thumbnail(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, max(1, h*size/w)
+		} else {
+			tw, th = max(1, w*size/h), size
+		}
+	}
+
+	thumb := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := bounds.Min.Y+y*h/th, bounds.Min.Y+max((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := bounds.Min.X+x*w/tw, bounds.Min.X+max((x+1)*w/tw, x*w/tw+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			// on white background as thumbnails are jpeg
+			bg := 0xffff - a/n
+			thumb.Set(x, y, color.RGBA64{uint16(r/n + bg), uint16(g/n + bg), uint16(b/n + bg), 0xffff})
+		}
+	}
+	return thumb
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -10,3 +10,4 @@ export const basePathAddTarget = base + '/api/target/';
 export const basePathDeleteTarget = base + '/api/target/';
 export const basePathUpdateTarget = base + '/api/target/';
 export const basePathGetTargets = base + '/api/targets';
+export const basePathGetStyles = base + '/api/styles/'; // {id}/history
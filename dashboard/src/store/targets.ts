@@ -41,14 +41,21 @@ export const useTargets = defineStore('Targets', {
     },
 })
 
+export type StockState = 'unknown' | 'in_stock' | 'low_stock' | 'sold_out' | 'discontinued' | 'backorder'
+
 export interface Product {
     ID: number
     ProductCode: number
+    StyleID: number
     Name: string
     Colour: string
     Size: string
     ImageUrl: string
+    ThumbnailUrl: string
     TargetPrice: number
     Price: number
-    Stock: number
+    StockState: StockState
+    Stock: number // items left, low stock only
+    RestockDate: string | null // expected restock date of backorder
+    StockText: string // i.e. "3 left", "back in stock on 11/20"
 }
\ No newline at end of file